@@ -0,0 +1,230 @@
+// Package cli implements the migrate, plan, drift and dump-schema commands
+// for structs registered with postgres.Register.
+//
+// Structs are usually registered in init functions, so a binary only has to
+// import the packages that register them, see cmd/pgmigrate for a template:
+//
+//	import (
+//		"os"
+//
+//		"github.com/mattes/postgres/cli"
+//		_ "example.com/your/models" // registers structs
+//	)
+//
+//	func main() {
+//		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+//	}
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mattes/postgres"
+)
+
+// Exit codes returned by Run
+const (
+	ExitOK      = 0 // command succeeded, no changes or drift found
+	ExitError   = 1 // command failed
+	ExitUsage   = 2 // invalid command or flags
+	ExitChanges = 3 // plan found pending migrations, or drift found differences
+)
+
+// URIEnv is the environment variable used if -uri is not set.
+var URIEnv = "POSTGRES_URI"
+
+const usage = `Usage: <command> [flags]
+
+Commands:
+  migrate      run migrations for registered structs
+  plan         print pending migrations, exits with 3 if there are any
+  drift        print schema drift, exits with 3 if there is any
+  dump-schema  print the schema of registered structs, no database required
+
+Flags:
+  -uri string        Postgres URI (default $%v)
+  -timeout duration  max duration of the command (default 10m)
+  -json              print plan and drift as JSON
+`
+
+// Run runs the command given in args (without the program name)
+// and returns an exit code.
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintf(stderr, usage, URIEnv)
+		return ExitUsage
+	}
+
+	cmd := args[0]
+
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprintf(stderr, usage, URIEnv) }
+	uri := fs.String("uri", os.Getenv(URIEnv), "")
+	timeout := fs.Duration("timeout", 10*time.Minute, "")
+	asJSON := fs.Bool("json", false, "")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return ExitUsage
+	}
+
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "%v: unexpected arguments %v\n", cmd, fs.Args())
+		return ExitUsage
+	}
+
+	// dump-schema doesn't need a database
+	switch cmd {
+	case "dump-schema":
+		if err := postgres.DumpSchema(stdout); err != nil {
+			fmt.Fprintf(stderr, "%v: %v\n", cmd, err)
+			return ExitError
+		}
+		return ExitOK
+
+	case "migrate", "plan", "drift":
+
+	default:
+		fmt.Fprintf(stderr, "unknown command %v\n", cmd)
+		fs.Usage()
+		return ExitUsage
+	}
+
+	if *uri == "" {
+		fmt.Fprintf(stderr, "%v: -uri or $%v required\n", cmd, URIEnv)
+		return ExitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	db, err := postgres.Open(*uri)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v: %v\n", cmd, err)
+		return ExitError
+	}
+	defer db.Close()
+
+	var code int
+	switch cmd {
+	case "migrate":
+		err = db.Migrate(ctx)
+
+	case "plan":
+		code, err = plan(ctx, db, stdout, *asJSON)
+
+	case "drift":
+		code, err = drift(ctx, db, stdout, *asJSON)
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "%v: %v\n", cmd, err)
+		return ExitError
+	}
+
+	return code
+}
+
+func plan(ctx context.Context, db *postgres.Postgres, w io.Writer, asJSON bool) (int, error) {
+	steps, err := db.MigratePlan(ctx)
+	if err != nil {
+		return ExitError, err
+	}
+
+	if asJSON {
+		if err := json.NewEncoder(w).Encode(steps); err != nil {
+			return ExitError, err
+		}
+	} else {
+		for _, s := range steps {
+			fmt.Fprintf(w, "-- %v\n%v;\n\n", s.Reason, s.SQL)
+		}
+	}
+
+	if len(steps) > 0 {
+		return ExitChanges, nil
+	}
+	return ExitOK, nil
+}
+
+func drift(ctx context.Context, db *postgres.Postgres, w io.Writer, asJSON bool) (int, error) {
+	report, err := db.Drift(ctx)
+	if err != nil {
+		return ExitError, err
+	}
+
+	if asJSON {
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			return ExitError, err
+		}
+	} else {
+		printDrift(w, report)
+	}
+
+	if report.HasDrift() {
+		return ExitChanges, nil
+	}
+	return ExitOK, nil
+}
+
+func printDrift(w io.Writer, report *postgres.DriftReport) {
+	for _, t := range report.Tables {
+		if t.Missing {
+			fmt.Fprintf(w, "%v: table does not exist\n", t.Table)
+		}
+
+		for _, c := range t.MissingColumns {
+			fmt.Fprintf(w, "%v: missing column %v\n", t.Table, c)
+		}
+
+		for _, c := range t.ExtraColumns {
+			fmt.Fprintf(w, "%v: extra column %v\n", t.Table, c)
+		}
+
+		for _, c := range t.MismatchedColumns {
+			fmt.Fprintf(w, "%v: column %v is %v, expected %v\n",
+				t.Table, c.Column, columnStr(c.ActualType, c.ActualNullable), columnStr(c.ExpectedType, c.ExpectedNullable))
+		}
+
+		for _, i := range t.MissingIndexes {
+			fmt.Fprintf(w, "%v: missing index %v\n", t.Table, i)
+		}
+
+		for _, i := range t.StaleIndexes {
+			fmt.Fprintf(w, "%v: stale index %v\n", t.Table, i)
+		}
+
+		for _, fk := range t.MissingForeignKeys {
+			fmt.Fprintf(w, "%v: missing foreign key %v\n", t.Table, fk)
+		}
+
+		for _, fk := range t.MismatchedForeignKeys {
+			fmt.Fprintf(w, "%v: mismatched foreign key %v\n", t.Table, fk)
+		}
+
+		for _, c := range t.MissingChecks {
+			fmt.Fprintf(w, "%v: missing check %v\n", t.Table, c)
+		}
+
+		for _, c := range t.UnvalidatedChecks {
+			fmt.Fprintf(w, "%v: unvalidated check %v\n", t.Table, c)
+		}
+
+		for _, c := range t.MismatchedChecks {
+			fmt.Fprintf(w, "%v: mismatched check %v\n", t.Table, c)
+		}
+	}
+}
+
+func columnStr(dataType string, nullable bool) string {
+	if nullable {
+		return dataType + " null"
+	}
+	return dataType + " not null"
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mattes/postgres"
+	"github.com/stretchr/testify/require"
+)
+
+type TestCLI_Struct struct {
+	Id string `db:"pk"`
+}
+
+func init() {
+	postgres.Register(&TestCLI_Struct{}, "")
+}
+
+func run(args ...string) (code int, stdout, stderr string) {
+	o, e := &bytes.Buffer{}, &bytes.Buffer{}
+	code = Run(args, o, e)
+	return code, o.String(), e.String()
+}
+
+func TestRun_Usage(t *testing.T) {
+	code, _, stderr := run()
+	require.Equal(t, ExitUsage, code)
+	require.Contains(t, stderr, "Commands:")
+
+	code, _, stderr = run("foo")
+	require.Equal(t, ExitUsage, code)
+	require.Contains(t, stderr, "unknown command foo")
+
+	code, _, _ = run("plan", "-foo")
+	require.Equal(t, ExitUsage, code)
+
+	code, _, _ = run("plan", "bar")
+	require.Equal(t, ExitUsage, code)
+
+	code, _, stderr = run("migrate", "-uri", "")
+	require.Equal(t, ExitUsage, code)
+	require.Contains(t, stderr, "-uri")
+}
+
+func TestRun_DumpSchema(t *testing.T) {
+	code, stdout, _ := run("dump-schema")
+	require.Equal(t, ExitOK, code)
+	require.Contains(t, stdout, `CREATE TABLE IF NOT EXISTS "test_cli_struct"`)
+}
+
+func TestPrintDrift(t *testing.T) {
+	buf := &bytes.Buffer{}
+	printDrift(buf, &postgres.DriftReport{Tables: []postgres.TableDrift{
+		{Table: "foo", Missing: true},
+		{
+			Table:                 "bar",
+			ExtraColumns:          []string{"col4"},
+			MismatchedColumns:     []postgres.ColumnDrift{{Column: "col3", ExpectedType: "integer", ActualType: "bigint", ActualNullable: true}},
+			StaleIndexes:          []string{"bar_col3_index"},
+			MismatchedForeignKeys: []string{"bar_col1_fk"},
+			UnvalidatedChecks:     []string{"bar_col3_check"},
+		},
+	}})
+
+	expect := `foo: table does not exist
+bar: extra column col4
+bar: column col3 is bigint null, expected integer not null
+bar: stale index bar_col3_index
+bar: mismatched foreign key bar_col1_fk
+bar: unvalidated check bar_col3_check
+`
+	require.Equal(t, expect, buf.String())
+}
@@ -0,0 +1,21 @@
+// Command pgmigrate runs migrate, plan, drift and dump-schema for registered structs.
+//
+// This is a template: copy it into your repository and import the packages
+// that register your structs, so they are linked into the binary.
+//
+//	pgmigrate plan -uri postgres://localhost/db
+//	pgmigrate migrate -uri postgres://localhost/db
+//	pgmigrate drift -uri postgres://localhost/db
+//	pgmigrate dump-schema > schema.sql
+package main
+
+import (
+	"os"
+
+	"github.com/mattes/postgres/cli"
+	// _ "example.com/your/models" // registers structs with postgres.Register
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
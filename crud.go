@@ -5,11 +5,17 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type db interface {
 	QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row
 	Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 }
 
 func getStruct(db db, ctx context.Context, s Struct) error {
@@ -32,12 +38,139 @@ func getStruct(db db, ctx context.Context, s Struct) error {
 
 	row := db.QueryRow(ctx, query, p.args(r.fields)...)
 	if err := r.fields.Scan(row); err != nil {
+		return wrapError(s, r, err)
+	}
+
+	return nil
+}
+
+func getManyStruct(db db, ctx context.Context, s StructSlice) error {
+	if !isPointer(s) {
+		panic(fmt.Sprintf("expect *%T not %T", s, s))
+	}
+
+	sval := reflect.ValueOf(s)
+
+	// check if s is a slice
+	if sval.Elem().Kind() != reflect.Slice {
+		panic(fmt.Sprintf("expect []%T not %T", s, s))
+	}
+
+	// create empty struct based on s slice
+	typ := sval.Elem().Type().Elem()
+	sx := reflect.New(typ).Interface()
+
+	// get meta struct from slice'd type
+	r, err := newMetaStruct(sx) // don't use registered metaStruct here
+	if err != nil {
 		return err
 	}
 
+	pf := r.fields.primaryFields()
+	if len(pf) == 0 {
+		return fmt.Errorf("%v: missing primary key", r.name)
+	}
+
+	found := make([]bool, sval.Elem().Len())
+
+	// each struct needs one placeholder per primary key, so make sure
+	// a batch doesn't exceed the max number of placeholders
+	batchSize := maxPlaceholders / len(pf)
+
+	for offset := 0; offset < sval.Elem().Len(); offset += batchSize {
+		end := offset + batchSize
+		if end > sval.Elem().Len() {
+			end = sval.Elem().Len()
+		}
+
+		// keys maps primary keys to slice indexes
+		keys := make(map[string][]int)
+		values := make([]string, 0, end-offset)
+		args := make([]interface{}, 0)
+
+		for i := offset; i < end; i++ {
+			f := mustNewFields(sval.Elem().Index(i).Addr().Interface(), false)
+
+			key, err := primaryKey(f, pf)
+			if err != nil {
+				return err
+			}
+			keys[key] = append(keys[key], i)
+
+			row := make([]string, 0, len(pf))
+			for _, x := range pf {
+				args = append(args, f[x.position])
+				row = append(row, "$"+strconv.Itoa(len(args)))
+			}
+			values = append(values, "("+join(row)+")")
+		}
+
+		queryf := "SELECT %v FROM %v WHERE (%v) IN (%v)"
+		query := fmt.Sprintf(queryf,
+			mustJoinIdentifiers(r.fields.names()),
+			mustIdentifier(r.alias()),
+			mustJoinIdentifiers(r.fields.primaryNames()),
+			join(values))
+
+		rows, err := db.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			sx := reflect.New(typ)
+			f := mustNewFields(sx.Interface(), false)
+			if err := f.Scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+
+			key, err := primaryKey(f, pf)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			for _, i := range keys[key] {
+				sval.Elem().Index(i).Set(sx.Elem())
+				found[i] = true
+			}
+		}
+
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	missing := make([]int, 0)
+	for i, ok := range found {
+		if !ok {
+			missing = append(missing, i)
+		}
+	}
+
+	if len(missing) > 0 {
+		return &MissingRecordsError{Struct: structName(sx), Indexes: missing}
+	}
+
 	return nil
 }
 
+// primaryKey returns the encoded primary key values of f as string,
+// where pf are the primary key fields of the related metaStruct.
+func primaryKey(f fields, pf []*field) (string, error) {
+	out := make([]string, 0, len(pf))
+	for _, x := range pf {
+		v, err := f[x.position].Value()
+		if err != nil {
+			return "", err
+		}
+		out = append(out, fmt.Sprintf("%#v", v))
+	}
+	return strings.Join(out, ", "), nil
+}
+
 func filterStruct(db db, ctx context.Context, s StructSlice, q *QueryStmt) error {
 	if !isPointer(s) {
 		panic(fmt.Sprintf("expect *%T not %T", s, s))
@@ -65,36 +198,177 @@ func filterStruct(db db, ctx context.Context, s StructSlice, q *QueryStmt) error
 		return err
 	}
 
-	qx := queryf()
-	qx.Append("SELECT", mustJoinIdentifiers(r.fields.names()))
-	qx.Append("FROM", mustIdentifier(r.alias()))
-	qx.Append(q.queryStr()) // WHERE
-	qx.Append(q.orderStr()) // ORDER BY
-	qx.Append("LIMIT", q.limit)
+	query, args, err := filterQuery(r, q, true)
+	if err != nil {
+		return err
+	}
 
-	rows, err := db.Query(ctx, qx.String(), q.args...)
+	rows, err := db.Query(ctx, query, args...)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
+	q.nextPageToken = ""
+	n := 0
+	var last fields
+
 	for rows.Next() {
 		sx := reflect.New(typ).Interface()
-		if err := mustNewFields(sx, false).Scan(rows); err != nil {
+		last = mustNewFields(sx, false)
+		if err := last.Scan(rows); err != nil {
 			return err
 		}
 
 		// append to slice s
 		sval.Elem().Set(reflect.Append(sval.Elem(), reflect.ValueOf(sx).Elem()))
+		n++
 	}
 
 	if err := rows.Err(); err != nil {
 		return err
 	}
 
+	// a full page indicates that there might be more results
+	if q.paginate && n == q.limit {
+		q.nextPageToken, err = encodePageToken(r, q.keysetOrder(r), last)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func filterIterStruct(db db, ctx context.Context, s Struct, q *QueryStmt) (*Iterator, error) {
+	if !isPointer(s) {
+		panic(fmt.Sprintf("expect *%T not %T", s, s))
+	}
+
+	r, err := newMetaStruct(s) // don't use registered metaStruct here
+	if err != nil {
+		return nil, err
+	}
+
+	// verify the query, which is important if query contains untrusted user input
+	if err := q.validate(r); err != nil {
+		return nil, err
+	}
+
+	// only limit the results if a limit was set explicitly
+	query, args, err := filterQuery(r, q, q.hasLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Iterator{rows: rows, typ: typeOf(s)}, nil
+}
+
+func countStruct(db db, ctx context.Context, s Struct, q *QueryStmt) (int64, error) {
+	if !isPointer(s) {
+		panic(fmt.Sprintf("expect *%T not %T", s, s))
+	}
+
+	r, err := newMetaStruct(s) // don't use registered metaStruct here
+	if err != nil {
+		return 0, err
+	}
+
+	// verify the query, which is important if query contains untrusted user input
+	if err := q.validate(r); err != nil {
+		return 0, err
+	}
+
+	qx := queryf()
+	qx.Append("SELECT count(*)")
+	qx.Append("FROM", mustIdentifier(r.alias()))
+	qx.Append(q.queryStr()) // WHERE
+
+	var count int64
+	row := db.QueryRow(ctx, qx.String(), q.args...)
+	if err := row.Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func existsStruct(db db, ctx context.Context, s Struct, q *QueryStmt) (bool, error) {
+	if !isPointer(s) {
+		panic(fmt.Sprintf("expect *%T not %T", s, s))
+	}
+
+	r, err := newMetaStruct(s) // don't use registered metaStruct here
+	if err != nil {
+		return false, err
+	}
+
+	// verify the query, which is important if query contains untrusted user input
+	if err := q.validate(r); err != nil {
+		return false, err
+	}
+
+	qx := queryf()
+	qx.Append("SELECT EXISTS (SELECT 1")
+	qx.Append("FROM", mustIdentifier(r.alias()))
+	qx.Append(q.queryStr()) // WHERE
+	qx.Append(")")
+
+	var exists bool
+	row := db.QueryRow(ctx, qx.String(), q.args...)
+	if err := row.Scan(&exists); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// filterQuery returns the SELECT query and its args for a validated QueryStmt
+func filterQuery(r *metaStruct, q *QueryStmt, limit bool) (string, []interface{}, error) {
+	args := q.args
+
+	qx := queryf()
+	qx.Append("SELECT", mustJoinIdentifiers(r.fields.names()))
+	qx.Append("FROM", mustIdentifier(r.alias()))
+
+	if q.paginate {
+		order := q.keysetOrder(r)
+
+		if q.after != "" {
+			values, err := decodePageToken(r, order, q.after)
+			if err != nil {
+				return "", nil, err
+			}
+
+			if q.query != "" {
+				qx.Appendf("WHERE (%v) AND %v", q.query, keysetStr(order, len(q.args)))
+			} else {
+				qx.Appendf("WHERE %v", keysetStr(order, len(q.args)))
+			}
+			args = append(append(make([]interface{}, 0, len(q.args)+len(values)), q.args...), values...)
+		} else {
+			qx.Append(q.queryStr()) // WHERE
+		}
+
+		qx.Append(orderStr(order)) // ORDER BY
+
+	} else {
+		qx.Append(q.queryStr()) // WHERE
+		qx.Append(q.orderStr()) // ORDER BY
+	}
+
+	if limit {
+		qx.Append("LIMIT", q.limit)
+	}
+
+	return qx.String(), args, nil
+}
+
 func saveStruct(db db, ctx context.Context, s Struct, fieldMask ...StructFieldName) error {
 	if !isPointer(s) {
 		panic(fmt.Sprintf("expect *%T not %T", s, s))
@@ -120,9 +394,133 @@ func saveStruct(db db, ctx context.Context, s Struct, fieldMask ...StructFieldNa
 
 	row := db.QueryRow(ctx, query, p.args(r.fields)...)
 	if err := r.fields.Scan(row); err != nil {
+		return wrapError(s, r, err)
+	}
+
+	return nil
+}
+
+func saveManyStruct(db db, ctx context.Context, s StructSlice, fieldMask ...StructFieldName) error {
+	if !isPointer(s) {
+		panic(fmt.Sprintf("expect *%T not %T", s, s))
+	}
+
+	sval := reflect.ValueOf(s)
+
+	// check if s is a slice
+	if sval.Elem().Kind() != reflect.Slice {
+		panic(fmt.Sprintf("expect []%T not %T", s, s))
+	}
+
+	// create empty struct based on s slice
+	typ := sval.Elem().Type().Elem()
+	sx := reflect.New(typ).Interface()
+
+	// get meta struct from slice'd type
+	r, err := newMetaStruct(sx) // don't use registered metaStruct here
+	if err != nil {
+		return err
+	}
+
+	pf := r.fields.primaryFields()
+	if len(pf) == 0 {
+		return fmt.Errorf("%v: missing primary key", r.name)
+	}
+
+	// each row needs one placeholder per column, so make sure
+	// a batch doesn't exceed the max number of placeholders
+	batchSize := maxPlaceholders / len(r.fields.names(fieldMask...))
+
+	for offset := 0; offset < sval.Elem().Len(); offset += batchSize {
+		end := offset + batchSize
+		if end > sval.Elem().Len() {
+			end = sval.Elem().Len()
+		}
+
+		// keys maps primary keys to slice indexes
+		keys := make(map[string][]int)
+		values := make([]string, 0, end-offset)
+		args := make([]interface{}, 0)
+
+		for i := offset; i < end; i++ {
+			f := mustNewFields(sval.Elem().Index(i).Addr().Interface(), false)
+
+			key, err := primaryKey(f, pf)
+			if err != nil {
+				return err
+			}
+			keys[key] = append(keys[key], i)
+
+			row := make([]string, 0, len(f))
+			for _, x := range f.fieldMask(fieldMask) {
+				args = append(args, x)
+				row = append(row, "$"+strconv.Itoa(len(args)))
+			}
+			values = append(values, "("+join(row)+")")
+		}
+
+		queryf := "INSERT INTO %v (%v) VALUES %v ON CONFLICT (%v) DO UPDATE SET (%v) = ROW(%v) RETURNING %v"
+		query := fmt.Sprintf(queryf,
+			mustIdentifier(r.alias()),
+			mustJoinIdentifiers(r.fields.names(fieldMask...)),
+			join(values),
+			mustJoinIdentifiers(r.fields.primaryNames()),
+			mustJoinIdentifiers(r.fields.nonPrimaryNames(fieldMask...)),
+			mustJoinIdentifiersWithPrefix(r.fields.nonPrimaryNames(fieldMask...), "EXCLUDED"),
+			mustJoinIdentifiers(r.fields.names()),
+		)
+
+		if err := scanMany(db, ctx, sval.Elem(), keys, pf, end-offset, query, args...); err != nil {
+			return wrapError(sx, r, err)
+		}
+	}
+
+	return nil
+}
+
+// scanMany runs query and scans the returned rows into the slice elements
+// with the same primary key, as Postgres doesn't guarantee the order of
+// returned rows. keys maps primary keys to slice indexes, see primaryKey.
+func scanMany(db db, ctx context.Context, slice reflect.Value, keys map[string][]int, pf []*field, n int, query string, args ...interface{}) error {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	typ := slice.Type().Elem()
+	scanned := 0
+	for rows.Next() {
+		sx := reflect.New(typ)
+		f := mustNewFields(sx.Interface(), false)
+		if err := f.Scan(rows); err != nil {
+			return err
+		}
+
+		key, err := primaryKey(f, pf)
+		if err != nil {
+			return err
+		}
+
+		indexes, ok := keys[key]
+		if !ok {
+			return fmt.Errorf("returned row with unknown primary key %v", key)
+		}
+
+		for _, i := range indexes {
+			slice.Index(i).Set(sx.Elem())
+		}
+		scanned++
+	}
+
+	if err := rows.Err(); err != nil {
 		return err
 	}
 
+	if scanned != n {
+		return fmt.Errorf("expected %v rows, got %v", n, scanned)
+	}
+
 	return nil
 }
 
@@ -148,12 +546,92 @@ func insertStruct(db db, ctx context.Context, s Struct, fieldMask ...StructField
 
 	row := db.QueryRow(ctx, query, p.args(r.fields)...)
 	if err := r.fields.Scan(row); err != nil {
+		return wrapError(s, r, err)
+	}
+
+	return nil
+}
+
+func insertManyStruct(t *Transaction, ctx context.Context, s StructSlice, fieldMask ...StructFieldName) error {
+	if !isPointer(s) {
+		panic(fmt.Sprintf("expect *%T not %T", s, s))
+	}
+
+	sval := reflect.ValueOf(s)
+
+	// check if s is a slice
+	if sval.Elem().Kind() != reflect.Slice {
+		panic(fmt.Sprintf("expect []%T not %T", s, s))
+	}
+
+	if sval.Elem().Len() == 0 {
+		return nil
+	}
+
+	// create empty struct based on s slice
+	typ := sval.Elem().Type().Elem()
+	sx := reflect.New(typ).Interface()
+
+	// get meta struct from slice'd type
+	r, err := newMetaStruct(sx) // don't use registered metaStruct here
+	if err != nil {
+		return err
+	}
+
+	// pq.CopyIn quotes the identifiers itself
+	query := pq.CopyIn(r.alias(), stringSliceToSnake(r.fields.names(fieldMask...))...)
+
+	start := time.Now()
+	stmt, err := t.tx.PrepareContext(ctx, query)
+	if err != nil {
 		return err
 	}
+	defer stmt.Close()
+
+	for i := 0; i < sval.Elem().Len(); i++ {
+		f := mustNewFields(sval.Elem().Index(i).Addr().Interface(), false)
+
+		values, err := copyValues(f.fieldMask(fieldMask))
+		if err != nil {
+			return err
+		}
+
+		if _, err := stmt.ExecContext(ctx, values...); err != nil {
+			return wrapError(sx, r, err)
+		}
+	}
+
+	// flush buffered rows
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return wrapError(sx, r, err)
+	}
+	t.logQuery(query, time.Since(start))
 
 	return nil
 }
 
+// copyValues encodes fields for pq.CopyIn. COPY sends []byte as bytea,
+// so []byte values of all other column types, like jsonb or text,
+// are passed on as string instead.
+func copyValues(f []*field) ([]interface{}, error) {
+	out := make([]interface{}, 0, len(f))
+	for _, x := range f {
+		v, err := x.Value()
+		if err != nil {
+			return nil, err
+		}
+
+		if b, ok := v.([]byte); ok {
+			if dataType, _ := parseColumnType(x.columnType()); dataType != "bytea" {
+				v = string(b)
+			}
+		}
+
+		out = append(out, v)
+	}
+	return out, nil
+}
+
 func updateStruct(db db, ctx context.Context, s Struct, fieldMask ...StructFieldName) error {
 	if !isPointer(s) {
 		panic(fmt.Sprintf("expect *%T not %T", s, s))
@@ -177,12 +655,75 @@ func updateStruct(db db, ctx context.Context, s Struct, fieldMask ...StructField
 
 	row := db.QueryRow(ctx, query, p.args(r.fields)...)
 	if err := r.fields.Scan(row); err != nil {
-		return err
+		return wrapError(s, r, err)
 	}
 
 	return nil
 }
 
+func updateWhereStruct(db db, ctx context.Context, s Struct, q *QueryStmt, fieldMask ...StructFieldName) (int64, error) {
+	if !isPointer(s) {
+		panic(fmt.Sprintf("expect *%T not %T", s, s))
+	}
+
+	r, err := newMetaStruct(s) // don't use registered metaStruct here
+	if err != nil {
+		return 0, err
+	}
+
+	// verify the query, which is important if query contains untrusted user input
+	if err := q.validate(r); err != nil {
+		return 0, err
+	}
+
+	// placeholders for updated values follow the query's args
+	args := append(make([]interface{}, 0), q.args...)
+	values := make([]string, 0)
+	for _, x := range r.fields.nonPrimaryFields(fieldMask...) {
+		args = append(args, x)
+		values = append(values, "$"+strconv.Itoa(len(args)))
+	}
+
+	qx := queryf()
+	qx.Append("UPDATE", mustIdentifier(r.alias()))
+	qx.Appendf("SET (%v) = ROW(%v)", mustJoinIdentifiers(r.fields.nonPrimaryNames(fieldMask...)), join(values))
+	qx.Append(q.queryStr()) // WHERE
+
+	result, err := db.Exec(ctx, qx.String(), args...)
+	if err != nil {
+		return 0, wrapError(s, r, err)
+	}
+
+	return result.RowsAffected()
+}
+
+func deleteWhereStruct(db db, ctx context.Context, s Struct, q *QueryStmt) (int64, error) {
+	if !isPointer(s) {
+		panic(fmt.Sprintf("expect *%T not %T", s, s))
+	}
+
+	r, err := newMetaStruct(s) // don't use registered metaStruct here
+	if err != nil {
+		return 0, err
+	}
+
+	// verify the query, which is important if query contains untrusted user input
+	if err := q.validate(r); err != nil {
+		return 0, err
+	}
+
+	qx := queryf()
+	qx.Append("DELETE FROM", mustIdentifier(r.alias()))
+	qx.Append(q.queryStr()) // WHERE
+
+	result, err := db.Exec(ctx, qx.String(), q.args...)
+	if err != nil {
+		return 0, wrapError(s, r, err)
+	}
+
+	return result.RowsAffected()
+}
+
 func deleteStruct(db db, ctx context.Context, s Struct) error {
 	if !isPointer(s) {
 		panic(fmt.Sprintf("expect *%T not %T", s, s))
@@ -203,7 +744,7 @@ func deleteStruct(db db, ctx context.Context, s Struct) error {
 
 	row := db.QueryRow(ctx, query, p.args(r.fields)...)
 	if err := r.fields.Scan(row); err != nil {
-		return err
+		return wrapError(s, r, err)
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"database/sql/driver"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -134,3 +135,47 @@ func TestDeleteStruct_UsesAlias(t *testing.T) {
 
 	log.Equal(t, "test_data/test_delete_struct_uses_alias.txt")
 }
+
+type testCopyValue string
+
+func (v testCopyValue) Value() (driver.Value, error) {
+	return []byte(v), nil
+}
+
+type testCopyJSON struct{ testCopyValue }
+
+func (testCopyJSON) ColumnType() string {
+	return "JSON null"
+}
+
+type testCopyText struct{ testCopyValue }
+
+func (testCopyText) ColumnType() string {
+	return "text not null default ''"
+}
+
+type testCopyBytea struct{ testCopyValue }
+
+func (testCopyBytea) ColumnType() string {
+	return "BYTEA null"
+}
+
+type TestCopyValues_Struct struct {
+	Col1 testCopyJSON
+	Col2 testCopyText
+	Col3 testCopyBytea
+}
+
+func TestCopyValues(t *testing.T) {
+	s := &TestCopyValues_Struct{
+		Col1: testCopyJSON{`{"a": 1}`},
+		Col2: testCopyText{"abc"},
+		Col3: testCopyBytea{"def"},
+	}
+
+	values, err := copyValues(mustNewFields(s, true))
+	require.NoError(t, err)
+
+	// only bytea columns get []byte, so COPY stores the same data as INSERT
+	require.Equal(t, []interface{}{`{"a": 1}`, "abc", []byte("def")}, values)
+}
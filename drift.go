@@ -0,0 +1,475 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// DriftReport lists differences between registered structs and the database
+// that Migrate does not resolve, see Drift.
+type DriftReport struct {
+	// Tables contains one entry for every table with drift
+	Tables []TableDrift
+}
+
+// HasDrift returns true if at least one table drifted.
+func (d *DriftReport) HasDrift() bool {
+	return len(d.Tables) > 0
+}
+
+// TableDrift lists differences between a struct and its table.
+type TableDrift struct {
+	// Table is the name of the table
+	Table string
+
+	// Missing is true if the table doesn't exist
+	Missing bool
+
+	// MissingColumns are columns for struct fields that don't exist
+	MissingColumns []string
+
+	// ExtraColumns are columns without a struct field
+	ExtraColumns []string
+
+	// MismatchedColumns are columns whose data type or nullability
+	// differs from the struct field's column type
+	MismatchedColumns []ColumnDrift
+
+	// MissingIndexes are indexes from struct tags that don't exist
+	MissingIndexes []string
+
+	// StaleIndexes are indexes that are not described by any struct tag,
+	// or whose definition differs from the struct tag
+	StaleIndexes []string
+
+	// MissingForeignKeys are foreign key constraints that don't exist
+	MissingForeignKeys []string
+
+	// MismatchedForeignKeys are foreign key constraints whose columns,
+	// onDelete action or deferrability differ from the struct tag
+	MismatchedForeignKeys []string
+
+	// MissingChecks are check constraints that don't exist
+	MissingChecks []string
+
+	// UnvalidatedChecks are check constraints that exist, but are not validated
+	// for existing rows yet, see Migrate
+	UnvalidatedChecks []string
+
+	// MismatchedChecks are check constraints whose expression
+	// differs from the struct tag
+	MismatchedChecks []string
+}
+
+func (t *TableDrift) hasDrift() bool {
+	return t.Missing ||
+		len(t.MissingColumns) > 0 ||
+		len(t.ExtraColumns) > 0 ||
+		len(t.MismatchedColumns) > 0 ||
+		len(t.MissingIndexes) > 0 ||
+		len(t.StaleIndexes) > 0 ||
+		len(t.MissingForeignKeys) > 0 ||
+		len(t.MismatchedForeignKeys) > 0 ||
+		len(t.MissingChecks) > 0 ||
+		len(t.UnvalidatedChecks) > 0 ||
+		len(t.MismatchedChecks) > 0
+}
+
+// ColumnDrift describes a column whose type differs from the struct field.
+type ColumnDrift struct {
+	Column string
+
+	// ExpectedType and ActualType are data types as reported
+	// by information_schema.columns, i.e. `timestamp without time zone`
+	ExpectedType string
+	ActualType   string
+
+	ExpectedNullable bool
+	ActualNullable   bool
+}
+
+// Drift compares all registered structs with the database and reports
+// extra, missing and mismatched columns, missing and stale indexes
+// missing or mismatched foreign keys and missing, unvalidated or mismatched
+// check constraints. Drift does not change the database.
+func (p *Postgres) Drift(ctx context.Context) (*DriftReport, error) {
+	report := &DriftReport{Tables: make([]TableDrift, 0)}
+
+	for _, r := range registeredStructs() {
+		d, err := p.drift(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+
+		if d.hasDrift() {
+			report.Tables = append(report.Tables, *d)
+		}
+	}
+
+	return report, nil
+}
+
+func (p *Postgres) drift(ctx context.Context, r *metaStruct) (*TableDrift, error) {
+	d := &TableDrift{Table: toSnake(r.name)}
+
+	tbl, err := p.describeTable(ctx, toSnake(r.name))
+	if isErrTableDoesNotExist(err) {
+		d.Missing = true
+		return d, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// compare columns
+	for _, f := range r.fields {
+		c, ok := tbl.column(f.name)
+		if !ok {
+			d.MissingColumns = append(d.MissingColumns, toSnake(f.name))
+			continue
+		}
+
+		expectedType, expectedNullable := parseColumnType(f.columnType())
+
+		// primary keys are always not null
+		if stringSliceContains(r.fields.primaryNames(), f.name) {
+			expectedNullable = false
+		}
+
+		if !equalDataType(expectedType, c.DataType) || expectedNullable != bool(c.IsNullable) {
+			d.MismatchedColumns = append(d.MismatchedColumns, ColumnDrift{
+				Column:           c.Name,
+				ExpectedType:     expectedType,
+				ActualType:       c.DataType,
+				ExpectedNullable: expectedNullable,
+				ActualNullable:   bool(c.IsNullable),
+			})
+		}
+	}
+
+	for _, c := range tbl.Columns {
+		if !r.fields.hasColumnName(c.Name) {
+			d.ExtraColumns = append(d.ExtraColumns, c.Name)
+		}
+	}
+
+	// compare indexes
+	expected, err := p.renderIndexes(ctx, toSnake(r.name), r.expectedIndexes())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, x := range expected {
+		if !tbl.hasIndexByName(x.Name) {
+			d.MissingIndexes = append(d.MissingIndexes, x.Name)
+		}
+	}
+
+	for _, i := range tbl.Indexes {
+		stale := true
+		for _, x := range expected {
+			if i.equal(x) {
+				stale = false
+				break
+			}
+		}
+
+		if stale {
+			d.StaleIndexes = append(d.StaleIndexes, i.Name)
+		}
+	}
+
+	// compare foreign keys
+	foreignKeys, err := p.describeForeignKeys(ctx, toSnake(r.name))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range r.fields {
+		for _, fk := range f.foreignKeys {
+			name := toSnake(r.name, f.name, "fk")
+			x, exists := foreignKeys[name]
+			if !exists {
+				d.MissingForeignKeys = append(d.MissingForeignKeys, name)
+			} else if !fk.equal(f.name, x) {
+				d.MismatchedForeignKeys = append(d.MismatchedForeignKeys, name)
+			}
+		}
+	}
+
+	// compare check constraints
+	checks, err := r.fields.checks()
+	if err != nil {
+		return nil, err
+	}
+
+	existingChecks, err := p.describeChecks(ctx, toSnake(r.name))
+	if err != nil {
+		return nil, err
+	}
+
+	definitions, err := p.renderChecks(ctx, toSnake(r.name), checks)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, c := range checks {
+		name := toSnake(r.name, c.name)
+		x, exists := existingChecks[name]
+		if !exists {
+			d.MissingChecks = append(d.MissingChecks, name)
+		} else if !x.hasDefinition(definitions[i]) {
+			d.MismatchedChecks = append(d.MismatchedChecks, name)
+		} else if !x.Validated {
+			d.UnvalidatedChecks = append(d.UnvalidatedChecks, name)
+		}
+	}
+
+	return d, nil
+}
+
+// expectedIndexes returns all indexes that Migrate creates on the struct's table,
+// including unique indexes for foreign keys of other registered structs,
+// unless another unique index already covers the referenced columns.
+func (m *metaStruct) expectedIndexes() []index {
+	out := make([]index, 0)
+
+	if primaryNames := m.fields.primaryNames(); len(primaryNames) > 0 {
+		out = append(out, index{
+			Name:      toSnake(m.name, "pk"),
+			Type:      "btree",
+			Columns:   primaryNames,
+			IsUnique:  true,
+			IsPrimary: true,
+		})
+	}
+
+	uniqueIndexes := m.fields.uniqueIndexes()
+	for _, indexName := range sortedKeys(uniqueIndexes) {
+		out = append(out, newIndex(toSnake(m.name, indexName), uniqueIndexes[indexName], m.fields.indexTag(indexName, true)))
+	}
+
+	indexes := m.fields.indexes()
+	for _, indexName := range sortedKeys(indexes) {
+		out = append(out, newIndex(toSnake(m.name, indexName), indexes[indexName], m.fields.indexTag(indexName, false)))
+	}
+
+	for _, x := range registeredStructs() {
+		for _, f := range x.fields {
+			for _, fk := range f.foreignKeys {
+				if toSnake(fk.structName) != toSnake(m.name) {
+					continue
+				}
+
+				// ensureForeignKeys doesn't create an index if the pk or
+				// another unique index covers the referenced columns
+				if (&table{Indexes: out}).hasUniqueIndexByColumns(fk.fieldNames) {
+					continue
+				}
+
+				out = append(out, index{
+					Name:     toSnake(fk.structName, join(fk.fieldNames), "unique"),
+					Type:     "btree",
+					Columns:  fk.fieldNames,
+					IsUnique: true,
+				})
+			}
+		}
+	}
+
+	return out
+}
+
+// renderIndexes returns indexes with expressions and predicates as Postgres
+// renders them, so that they compare equal to indexes of describeTableIndexes.
+// The indexes are created on an empty copy of the table, see withRenderTable.
+func (p *Postgres) renderIndexes(ctx context.Context, tableName string, indexes []index) ([]index, error) {
+	out := make([]index, len(indexes))
+	copy(out, indexes)
+
+	render := false
+	for _, x := range out {
+		render = render || bool(x.IsFunctional) || bool(x.IsPartial)
+	}
+	if !render {
+		return out, nil
+	}
+
+	err := p.withRenderTable(ctx, tableName, func(tx *Transaction, renderTable string) error {
+		for i, x := range out {
+			if !x.IsFunctional && !x.IsPartial {
+				continue
+			}
+
+			name := fmt.Sprintf("%v_%v", renderTable, i)
+
+			q := queryf()
+			q.Appendf("CREATE INDEX %v ON %v USING %v", mustIdentifier(name), mustIdentifier(renderTable), x.Type)
+			if x.IsFunctional {
+				q.Appendf("((%v))", x.Columns[0])
+			} else {
+				columns := make([]string, 0, len(x.Columns))
+				for _, c := range x.Columns {
+					column, order := splitIndexColumn(c)
+					columns = append(columns, mustIdentifier(toSnake(column))+order)
+				}
+				q.Appendf("(%v)", strings.Join(columns, ", "))
+			}
+			if x.Where != "" {
+				q.Append("WHERE", x.Where)
+			}
+
+			if _, err := tx.Exec(ctx, q.String()); err != nil {
+				return err
+			}
+
+			queryf := `
+SELECT
+  ARRAY(
+    SELECT pg_get_indexdef(idx.indexrelid, k + 1, TRUE) || CASE WHEN idx.indoption[k] & 1 = 1 THEN ' DESC' ELSE '' END
+    FROM generate_subscripts(idx.indkey, 1) AS k ORDER BY k
+  ),
+  COALESCE(pg_get_expr(idx.indpred, idx.indrelid, TRUE), '')
+FROM pg_index AS idx
+WHERE idx.indexrelid = %v :: REGCLASS`
+
+			var columns []string
+			row := tx.QueryRow(ctx, fmt.Sprintf(queryf, QuoteLiteral("pg_temp."+name)))
+			if err := row.Scan(pq.Array(&columns), &out[i].Where); err != nil {
+				return err
+			}
+			out[i].Columns = unquoteIndexColumns(columns)
+		}
+		return nil
+	})
+
+	return out, err
+}
+
+// renderChecks returns the definitions of checks as pg_get_constraintdef renders
+// them, i.e. `CHECK ((amount >= 0))`. The checks are added to an empty copy of
+// the table, see withRenderTable.
+func (p *Postgres) renderChecks(ctx context.Context, tableName string, checks []checkStructTag) ([]string, error) {
+	out := make([]string, len(checks))
+	if len(checks) == 0 {
+		return out, nil
+	}
+
+	err := p.withRenderTable(ctx, tableName, func(tx *Transaction, renderTable string) error {
+		for i, c := range checks {
+			name := fmt.Sprintf("%v_%v", renderTable, i)
+
+			queryf := "ALTER TABLE %v ADD CONSTRAINT %v CHECK (%v)"
+			if _, err := tx.Exec(ctx, fmt.Sprintf(queryf, mustIdentifier(renderTable), mustIdentifier(name), c.expr)); err != nil {
+				return err
+			}
+
+			queryf = "SELECT pg_get_constraintdef(oid) FROM pg_constraint WHERE conrelid = %v :: REGCLASS AND conname = %v"
+			row := tx.QueryRow(ctx, fmt.Sprintf(queryf, QuoteLiteral("pg_temp."+renderTable), QuoteLiteral(name)))
+			if err := row.Scan(&out[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return out, err
+}
+
+// withRenderTable calls fn with an empty temporary copy of the table, in a transaction
+// that is rolled back afterwards. Expressions added to the copy are rendered by Postgres
+// just like on the table itself.
+func (p *Postgres) withRenderTable(ctx context.Context, tableName string, fn func(tx *Transaction, renderTable string) error) error {
+	tx, err := p.NewTransactionContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	renderTable := "render_expressions"
+	query := fmt.Sprintf("CREATE TEMPORARY TABLE %v (LIKE %v) ON COMMIT DROP", mustIdentifier(renderTable), mustIdentifier(tableName))
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	return fn(tx, renderTable)
+}
+
+var (
+	columnTypeKeywords = []string{" not null", " null", " default ", " primary key", " unique", " check", " references", " collate", " generated"}
+	columnTypeModifier = regexp.MustCompile(`\s*\([^)]*\)`)
+
+	// dataTypeAliases maps type aliases to names used by information_schema
+	dataTypeAliases = map[string]string{
+		"int":         "integer",
+		"int4":        "integer",
+		"serial":      "integer",
+		"int2":        "smallint",
+		"smallserial": "smallint",
+		"int8":        "bigint",
+		"bigserial":   "bigint",
+		"bool":        "boolean",
+		"varchar":     "character varying",
+		"char":        "character",
+		"float4":      "real",
+		"float8":      "double precision",
+		"decimal":     "numeric",
+		"timestamp":   "timestamp without time zone",
+		"timestamptz": "timestamp with time zone",
+		"time":        "time without time zone",
+		"timetz":      "time with time zone",
+	}
+)
+
+// parseColumnType splits a column type like `bigint not null default 0` into
+// the data type as reported by information_schema.columns and its nullability.
+func parseColumnType(columnType string) (dataType string, nullable bool) {
+	s := strings.ToLower(strings.TrimSpace(columnType))
+	nullable = !strings.Contains(s, "not null") && !strings.Contains(s, "primary key")
+
+	s = strings.TrimSpace(columnTypeModifier.ReplaceAllString(s[:columnTypeEnd(s, 0)], ""))
+
+	if strings.HasSuffix(s, "[]") {
+		return "ARRAY", nullable
+	}
+
+	if alias, ok := dataTypeAliases[s]; ok {
+		return alias, nullable
+	}
+
+	return s, nullable
+}
+
+// splitColumnType splits a column type like `bigint not null default 0`
+// into the SQL data type `bigint` and its default value `0`, if any.
+func splitColumnType(columnType string) (dataType, dflt string) {
+	s := strings.TrimSpace(columnType)
+	l := strings.ToLower(s)
+
+	dataType = strings.TrimSpace(s[:columnTypeEnd(l, 0)])
+	if i := strings.Index(l, " default "); i >= 0 {
+		start := i + len(" default ")
+		dflt = strings.TrimSpace(s[start:columnTypeEnd(l, start)])
+	}
+	return dataType, dflt
+}
+
+// columnTypeEnd returns the position of the first keyword after start
+func columnTypeEnd(columnType string, start int) int {
+	end := len(columnType)
+	for _, keyword := range columnTypeKeywords {
+		if i := strings.Index(columnType[start:], keyword); i >= 0 && start+i < end {
+			end = start + i
+		}
+	}
+	return end
+}
+
+// equalDataType compares data types as reported by information_schema.columns.
+// User-defined types, like enums, are always equal.
+func equalDataType(expected, actual string) bool {
+	return strings.EqualFold(actual, "USER-DEFINED") || strings.EqualFold(expected, actual)
+}
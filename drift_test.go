@@ -0,0 +1,199 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseColumnType(t *testing.T) {
+	tt := []struct {
+		in       string
+		dataType string
+		nullable bool
+	}{
+		{"text not null default ''", "text", false},
+		{"timestamp (6) without time zone null", "timestamp without time zone", true},
+		{"bigint not null default 0", "bigint", false},
+		{"text[] null", "ARRAY", true},
+		{"jsonb null", "jsonb", true},
+		{"VARCHAR(255) NOT NULL", "character varying", false},
+		{"int8", "bigint", true},
+		{"my_enum not null", "my_enum", false},
+	}
+
+	for _, x := range tt {
+		dataType, nullable := parseColumnType(x.in)
+		require.Equal(t, x.dataType, dataType, x.in)
+		require.Equal(t, x.nullable, nullable, x.in)
+	}
+
+	require.True(t, equalDataType("my_enum", "USER-DEFINED"))
+	require.False(t, equalDataType("text", "integer"))
+}
+
+func TestCheckHasDefinition(t *testing.T) {
+	require.True(t, check{Definition: "CHECK ((amount >= 0))"}.hasDefinition("CHECK ((amount >= 0))"))
+	require.True(t, check{Definition: "CHECK ((amount >= 0)) NOT VALID"}.hasDefinition("CHECK ((amount >= 0))"))
+	require.False(t, check{Definition: "CHECK ((amount > 0))"}.hasDefinition("CHECK ((amount >= 0))"))
+}
+
+func TestSplitColumnType(t *testing.T) {
+	tt := []struct {
+		in       string
+		dataType string
+		dflt     string
+	}{
+		{"text not null default ''", "text", "''"},
+		{"timestamp (6) without time zone null", "timestamp (6) without time zone", ""},
+		{"bigint not null default 0", "bigint", "0"},
+		{"VARCHAR(255) DEFAULT 'foo' NOT NULL", "VARCHAR(255)", "'foo'"},
+	}
+
+	for _, x := range tt {
+		dataType, dflt := splitColumnType(x.in)
+		require.Equal(t, x.dataType, dataType, x.in)
+		require.Equal(t, x.dflt, dflt, x.in)
+	}
+}
+
+type TestExpectedIndexes_StructA struct {
+	Id    string `db:"pk"`
+	Email string
+}
+
+type TestExpectedIndexes_StructB struct {
+	Id     string `db:"pk"`
+	AId    string `db:"references(struct=TestExpectedIndexes_StructA, field=Id)"`
+	AEmail string `db:"references(struct=TestExpectedIndexes_StructA, field=Email)"`
+}
+
+type TestExpectedIndexes_StructC struct {
+	Id     string `db:"pk"`
+	AEmail string `db:"references(struct=TestExpectedIndexes_StructA, field=Email)"`
+}
+
+func TestExpectedIndexes_ForeignKey(t *testing.T) {
+	Register(&TestExpectedIndexes_StructA{}, "")
+	Register(&TestExpectedIndexes_StructB{}, "")
+	Register(&TestExpectedIndexes_StructC{}, "")
+
+	r, ok := registeredStruct(&TestExpectedIndexes_StructA{})
+	require.True(t, ok)
+
+	// the pk covers Id, and Email is expected only once
+	names := make([]string, 0)
+	for _, x := range r.expectedIndexes() {
+		names = append(names, x.Name)
+	}
+	require.Equal(t, []string{"test_expected_indexes_struct_a_pk", "test_expected_indexes_struct_a_email_unique"}, names)
+}
+
+type TestDrift_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 string `db:"index"`
+	Col3 int
+}
+
+func TestDrift(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	r := mustNewMetaStruct(&TestDrift_Struct{})
+	require.NoError(t, db.ensureTable(context.Background(), r))
+
+	// no drift right after migration
+	d, err := db.drift(context.Background(), r)
+	require.NoError(t, err)
+	require.False(t, d.hasDrift())
+
+	// change the table behind the struct's back
+	_, err = db.Exec(context.Background(), `ALTER TABLE test_drift_struct ADD COLUMN col4 text`)
+	require.NoError(t, err)
+	_, err = db.Exec(context.Background(), `ALTER TABLE test_drift_struct ALTER COLUMN col3 TYPE bigint`)
+	require.NoError(t, err)
+	_, err = db.Exec(context.Background(), `DROP INDEX test_drift_struct_col2_index`)
+	require.NoError(t, err)
+	_, err = db.Exec(context.Background(), `CREATE INDEX test_drift_struct_col3_index ON test_drift_struct (col3)`)
+	require.NoError(t, err)
+
+	d, err = db.drift(context.Background(), r)
+	require.NoError(t, err)
+	require.Equal(t, &TableDrift{
+		Table:        "test_drift_struct",
+		ExtraColumns: []string{"col4"},
+		MismatchedColumns: []ColumnDrift{
+			{Column: "col3", ExpectedType: "integer", ActualType: "bigint"},
+		},
+		MissingIndexes: []string{"test_drift_struct_col2_index"},
+		StaleIndexes:   []string{"test_drift_struct_col3_index"},
+	}, d)
+}
+
+type TestDrift_ForeignKey_StructA struct {
+	Id string `db:"pk"`
+}
+
+type TestDrift_ForeignKey_StructB struct {
+	Id  string `db:"pk"`
+	AId string `db:"references(struct=TestDrift_ForeignKey_StructA, field=Id, onDelete=restrict, deferrable=true)"`
+}
+
+func TestDrift_ForeignKey(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	a := mustNewMetaStruct(&TestDrift_ForeignKey_StructA{})
+	b := mustNewMetaStruct(&TestDrift_ForeignKey_StructB{})
+	require.NoError(t, db.ensureTable(context.Background(), a))
+	require.NoError(t, db.ensureTable(context.Background(), b))
+	require.NoError(t, db.ensureForeignKeys(context.Background(), b))
+
+	// no drift right after migration
+	d, err := db.drift(context.Background(), b)
+	require.NoError(t, err)
+	require.False(t, d.hasDrift())
+
+	// replace the foreign key with one that has default options
+	_, err = db.Exec(context.Background(), `ALTER TABLE test_drift_foreign_key_struct_b DROP CONSTRAINT test_drift_foreign_key_struct_b_a_id_fk`)
+	require.NoError(t, err)
+	_, err = db.Exec(context.Background(), `ALTER TABLE test_drift_foreign_key_struct_b ADD CONSTRAINT test_drift_foreign_key_struct_b_a_id_fk FOREIGN KEY (a_id) REFERENCES test_drift_foreign_key_struct_a (id) ON DELETE CASCADE`)
+	require.NoError(t, err)
+
+	d, err = db.drift(context.Background(), b)
+	require.NoError(t, err)
+	require.Equal(t, []string{"test_drift_foreign_key_struct_b_a_id_fk"}, d.MismatchedForeignKeys)
+	require.Empty(t, d.MissingForeignKeys)
+}
+
+type TestRenderChecks_Struct struct {
+	Id     string `db:"pk"`
+	Amount int
+	Status string
+}
+
+func TestRenderChecks(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	r := mustNewMetaStruct(&TestRenderChecks_Struct{})
+	require.NoError(t, db.ensureTable(context.Background(), r))
+
+	definitions, err := db.renderChecks(context.Background(), "test_render_checks_struct", []checkStructTag{
+		{name: "a", expr: "amount > -1"},
+		{name: "b", expr: "status IN ('open', 'closed')"},
+		{name: "c", expr: "(amount > 0 OR status = 'open') AND amount < 10"},
+		{name: "d", expr: "amount > 0 OR (status = 'open' AND amount < 10)"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "CHECK ((amount > '-1'::integer))", definitions[0])
+	require.Equal(t, "CHECK ((status = ANY (ARRAY['open'::text, 'closed'::text])))", definitions[1])
+
+	// precedence is kept
+	require.NotEqual(t, definitions[2], definitions[3])
+
+	// render table is gone
+	_, err = db.describeTable(context.Background(), "render_expressions")
+	require.True(t, isErrTableDoesNotExist(err))
+}
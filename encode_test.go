@@ -146,7 +146,7 @@ func TestEncoding(t *testing.T) {
 	db.Logger = log
 
 	// create table for it
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestTypesStruct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestTypesStruct{})))
 
 	// save data to postgres
 	err = db.Save(context.Background(), &tstruct, nil)
@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ErrNotFound is returned if no record was found for a struct.
+var ErrNotFound = errors.New("not found")
+
+// NotFoundError is returned by Get, Update and Delete if no record
+// was found for a struct. It matches ErrNotFound and, for backwards
+// compatibility, sql.ErrNoRows when used with errors.Is.
+type NotFoundError struct {
+	// Struct is the name of the Go struct
+	Struct string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Struct, ErrNotFound)
+}
+
+// Is reports whether target is ErrNotFound or sql.ErrNoRows.
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound || target == sql.ErrNoRows
+}
+
+// MissingRecordsError is returned by GetMany if no records were found
+// for some of the given structs. All other structs are loaded regardless.
+type MissingRecordsError struct {
+	// Struct is the name of the Go struct
+	Struct string
+
+	// Indexes are the positions of the missing structs in the slice
+	Indexes []int
+}
+
+func (e *MissingRecordsError) Error() string {
+	return fmt.Sprintf("%v: no records found for indexes %v", e.Struct, e.Indexes)
+}
+
+// Is reports whether target is ErrNotFound.
+func (e *MissingRecordsError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// UniqueViolationError is returned if a primary key or unique index
+// constraint is violated.
+type UniqueViolationError struct {
+	// Struct is the name of the Go struct
+	Struct string
+
+	// Constraint is the name of the violated constraint or index
+	Constraint string
+
+	// Fields are the Go field names covered by the constraint,
+	// if the constraint was created by Migrate.
+	Fields []string
+
+	Err *pq.Error
+}
+
+func (e *UniqueViolationError) Error() string {
+	return fmt.Sprintf("%v: unique violation on %v: %v", e.Struct, e.Fields, e.Err.Message)
+}
+
+func (e *UniqueViolationError) Unwrap() error {
+	return e.Err
+}
+
+// ForeignKeyViolationError is returned if a foreign key constraint is violated.
+type ForeignKeyViolationError struct {
+	// Struct is the name of the Go struct
+	Struct string
+
+	// Constraint is the name of the violated constraint
+	Constraint string
+
+	// Fields are the Go field names covered by the constraint,
+	// if the constraint was created by Migrate.
+	Fields []string
+
+	Err *pq.Error
+}
+
+func (e *ForeignKeyViolationError) Error() string {
+	return fmt.Sprintf("%v: foreign key violation on %v: %v", e.Struct, e.Fields, e.Err.Message)
+}
+
+func (e *ForeignKeyViolationError) Unwrap() error {
+	return e.Err
+}
+
+// CheckViolationError is returned if a check constraint is violated.
+type CheckViolationError struct {
+	// Struct is the name of the Go struct
+	Struct string
+
+	// Constraint is the name of the violated constraint
+	Constraint string
+
+	// Fields are the Go field names that declare the constraint,
+	// if the constraint was created by Migrate.
+	Fields []string
+
+	Err *pq.Error
+}
+
+func (e *CheckViolationError) Error() string {
+	return fmt.Sprintf("%v: check violation on %v: %v", e.Struct, e.Fields, e.Err.Message)
+}
+
+func (e *CheckViolationError) Unwrap() error {
+	return e.Err
+}
+
+// wrapError converts errors returned by the database into
+// the exported error types of this package.
+func wrapError(s Struct, r *metaStruct, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if err == sql.ErrNoRows {
+		return &NotFoundError{Struct: structName(s)}
+	}
+
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return err
+	}
+
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		return &UniqueViolationError{
+			Struct:     structName(s),
+			Constraint: pqErr.Constraint,
+			Fields:     r.constraintFields(pqErr.Constraint),
+			Err:        pqErr,
+		}
+
+	case "foreign_key_violation":
+		return &ForeignKeyViolationError{
+			Struct:     structName(s),
+			Constraint: pqErr.Constraint,
+			Fields:     r.constraintFields(pqErr.Constraint),
+			Err:        pqErr,
+		}
+
+	case "check_violation":
+		return &CheckViolationError{
+			Struct:     structName(s),
+			Constraint: pqErr.Constraint,
+			Fields:     r.constraintFields(pqErr.Constraint),
+			Err:        pqErr,
+		}
+	}
+
+	return err
+}
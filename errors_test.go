@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+type TestWrapError_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 string `db:"unique(name=foobar, composite=[Col3])"`
+	Col3 string
+	Col4 string `db:"references(struct=TestWrapError_Struct2, fields=[A, B])"`
+	Col5 string `db:"references(struct=TestWrapError_Struct2, fields=[A, B], composite=[Col6])"`
+	Col6 string
+	Col7 int `db:"check(expr='col7 >= 0')"`
+}
+
+func TestWrapError(t *testing.T) {
+	s := &TestWrapError_Struct{}
+	r := mustNewMetaStruct(s)
+
+	// not found
+	err := wrapError(s, r, sql.ErrNoRows)
+	require.True(t, errors.Is(err, ErrNotFound))
+	require.True(t, errors.Is(err, sql.ErrNoRows))
+	require.Equal(t, "TestWrapError_Struct: not found", err.Error())
+
+	var notFoundErr *NotFoundError
+	require.True(t, errors.As(err, &notFoundErr))
+	require.Equal(t, "TestWrapError_Struct", notFoundErr.Struct)
+
+	// primary key
+	err = wrapError(s, r, &pq.Error{Code: "23505", Constraint: "test_wrap_error_struct_pk"})
+	var uniqueErr *UniqueViolationError
+	require.True(t, errors.As(err, &uniqueErr))
+	require.Equal(t, "TestWrapError_Struct", uniqueErr.Struct)
+	require.Equal(t, []string{"Col1"}, uniqueErr.Fields)
+
+	// unique index
+	err = wrapError(s, r, &pq.Error{Code: "23505", Constraint: "test_wrap_error_struct_foobar"})
+	require.True(t, errors.As(err, &uniqueErr))
+	require.Equal(t, []string{"Col2", "Col3"}, uniqueErr.Fields)
+
+	// foreign key
+	err = wrapError(s, r, &pq.Error{Code: "23503", Constraint: "test_wrap_error_struct_col4_fk"})
+	var fkErr *ForeignKeyViolationError
+	require.True(t, errors.As(err, &fkErr))
+	require.Equal(t, []string{"Col4"}, fkErr.Fields)
+
+	// composite foreign key
+	err = wrapError(s, r, &pq.Error{Code: "23503", Constraint: "test_wrap_error_struct_col5_fk"})
+	require.True(t, errors.As(err, &fkErr))
+	require.Equal(t, []string{"Col5", "Col6"}, fkErr.Fields)
+
+	// check
+	err = wrapError(s, r, &pq.Error{Code: "23514", Constraint: "test_wrap_error_struct_col7_check"})
+	var checkErr *CheckViolationError
+	require.True(t, errors.As(err, &checkErr))
+	require.Equal(t, []string{"Col7"}, checkErr.Fields)
+
+	// underlying *pq.Error is still accessible
+	var pqErr *pq.Error
+	require.True(t, errors.As(err, &pqErr))
+
+	// unknown constraint
+	err = wrapError(s, r, &pq.Error{Code: "23505", Constraint: "foo"})
+	require.True(t, errors.As(err, &uniqueErr))
+	require.Nil(t, uniqueErr.Fields)
+
+	// other errors are returned as is
+	other := fmt.Errorf("foo")
+	require.Equal(t, other, wrapError(s, r, other))
+	require.Nil(t, wrapError(s, r, nil))
+}
+
+func TestMissingRecordsError(t *testing.T) {
+	err := error(&MissingRecordsError{Struct: "Foo", Indexes: []int{1, 3}})
+	require.True(t, errors.Is(err, ErrNotFound))
+	require.Equal(t, "Foo: no records found for indexes [1 3]", err.Error())
+}
@@ -73,6 +73,34 @@ func ExamplePostgres_Filter() {
 	// [{Id:user_5 Name:Max Email:max@example.com}]
 }
 
+func ExamplePostgres_FilterIter() {
+	db, _ := Open(postgresURI)
+	db.Migrate(context.Background())
+	db.Logger = print()
+
+	// Create a new user first
+	user := &User{
+		Id:    "user_10",
+		Name:  "Anna",
+		Email: "anna@example.org",
+	}
+	_ = db.Save(context.Background(), user)
+
+	// Iterate over users by email, one at a time
+	it, _ := db.FilterIter(context.Background(), &User{}, Query("Email LIKE $1", "%example.org"))
+	defer it.Close()
+
+	for it.Next() {
+		u := &User{}
+		_ = it.Scan(u)
+		fmt.Printf("%+v", u)
+	}
+	// Output:
+	// INSERT INTO "user" ("id", "name", "email") VALUES ($1, $2, $3) ON CONFLICT ("id") DO UPDATE SET ("name", "email") = ROW("excluded"."name", "excluded"."email") RETURNING "id", "name", "email"
+	// SELECT "id", "name", "email" FROM "user" WHERE "email" LIKE $1
+	// &{Id:user_10 Name:Anna Email:anna@example.org}
+}
+
 func ExamplePostgres_Insert() {
 	db, _ := Open(postgresURI)
 	db.Migrate(context.Background())
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	njson "encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -128,8 +129,9 @@ func mustNewMetaStruct(v interface{}) *metaStruct {
 }
 
 func requirePQError(t *testing.T, err error, codeName string) {
-	require.IsType(t, &pq.Error{}, err)
-	require.Equal(t, codeName, err.(*pq.Error).Code.Name())
+	var pqErr *pq.Error
+	require.True(t, errors.As(err, &pqErr), "expected *pq.Error, got %T", err)
+	require.Equal(t, codeName, pqErr.Code.Name())
 }
 
 func stringPtr(x string) *string {
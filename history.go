@@ -0,0 +1,260 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MigrationsTable is the name of the table that records applied versioned migrations.
+var MigrationsTable = "schema_migrations"
+
+var (
+	// migrations contains all registered versioned migrations by version
+	migrations   = make(map[int64]*migration)
+	migrationsMu sync.RWMutex
+
+	migrationFilename = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+)
+
+type migration struct {
+	version int64
+	name    string
+	upSQL   string
+}
+
+func (m *migration) String() string {
+	return fmt.Sprintf("%v_%v", m.version, m.name)
+}
+
+// checksum returns the hex encoded SHA-256 hash of the migration's SQL
+func (m *migration) checksum() string {
+	h := sha256.Sum256([]byte(m.upSQL))
+	return hex.EncodeToString(h[:])
+}
+
+// RegisterMigration registers a versioned SQL migration for hand-written DDL
+// or data fixes. Migrate applies registered migrations in order of their version,
+// after struct migrations and before anything is dropped. Each migration runs
+// in its own transaction and is recorded in MigrationsTable.
+//
+// Versions must be unique and greater than zero. The SQL of an applied
+// migration must not change, as Migrate verifies its checksum.
+func RegisterMigration(version int64, name, upSQL string) {
+	if err := registerMigrations(&migration{version: version, name: name, upSQL: upSQL}); err != nil {
+		panic(fmt.Sprintf("RegisterMigration: %v", err))
+	}
+}
+
+// RegisterMigrations registers all `<version>_<name>.sql` files in the root
+// directory of fs as versioned migrations, see RegisterMigration.
+// Use http.Dir to register migrations from a directory.
+func RegisterMigrations(fs http.FileSystem) error {
+	ms, err := loadMigrations(fs)
+	if err != nil {
+		return err
+	}
+
+	return registerMigrations(ms...)
+}
+
+// registerMigrations registers either all or none of the given migrations
+func registerMigrations(ms ...*migration) error {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+
+	seen := make(map[int64]bool)
+	for _, m := range ms {
+		if m.version <= 0 {
+			return fmt.Errorf("migration %v: version must be greater than zero", m)
+		}
+
+		if _, dup := migrations[m.version]; dup || seen[m.version] {
+			return fmt.Errorf("migration %v: version %v registered twice", m, m.version)
+		}
+		seen[m.version] = true
+	}
+
+	for _, m := range ms {
+		migrations[m.version] = m
+	}
+
+	return nil
+}
+
+// registeredMigrations returns all registered migrations sorted by version
+func registeredMigrations() []*migration {
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+
+	out := make([]*migration, 0, len(migrations))
+	for _, m := range migrations {
+		out = append(out, m)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].version < out[j].version
+	})
+	return out
+}
+
+func loadMigrations(fs http.FileSystem) ([]*migration, error) {
+	dir, err := fs.Open("/")
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	files, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*migration, 0)
+	for _, fi := range files {
+		if fi.IsDir() {
+			continue
+		}
+
+		version, name, ok := parseMigrationFilename(fi.Name())
+		if !ok {
+			continue
+		}
+
+		f, err := fs.Open("/" + fi.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		upSQL, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, &migration{version: version, name: name, upSQL: string(upSQL)})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].version < out[j].version
+	})
+	return out, nil
+}
+
+// parseMigrationFilename parses filenames like `0001_add_users.sql`
+func parseMigrationFilename(filename string) (version int64, name string, ok bool) {
+	m := migrationFilename.FindStringSubmatch(filename)
+	if m == nil {
+		return 0, "", false
+	}
+
+	version, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+
+	return version, m[2], true
+}
+
+// ensureMigrations applies all migrations that are not recorded in
+// MigrationsTable yet, and verifies checksums of applied migrations.
+func (p *Postgres) ensureMigrations(ctx context.Context, ms []*migration) error {
+	if len(ms) == 0 {
+		return nil
+	}
+
+	applied, err := p.appliedMigrations(ctx)
+	if isErrTableDoesNotExist(err) {
+		if err := p.createMigrationsTable(ctx); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	for _, m := range ms {
+		if checksum, ok := applied[m.version]; ok {
+			if checksum != m.checksum() {
+				return fmt.Errorf("migration %v: checksum does not match applied migration", m)
+			}
+			continue
+		}
+
+		if err := p.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("migration %v: %w", m, err)
+		}
+	}
+
+	return nil
+}
+
+// appliedMigrations returns checksums of applied migrations by version
+func (p *Postgres) appliedMigrations(ctx context.Context) (map[int64]string, error) {
+	query := fmt.Sprintf("SELECT version, checksum FROM %v", mustIdentifier(MigrationsTable))
+	rows, err := p.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[int64]string)
+	for rows.Next() {
+		var version int64
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		out[version] = checksum
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (p *Postgres) createMigrationsTable(ctx context.Context) error {
+	q := queryf()
+	q.Append("CREATE")
+
+	if p.createTempTables {
+		q.Append("TEMPORARY")
+	}
+
+	q.Appendf("TABLE IF NOT EXISTS %v", mustIdentifier(MigrationsTable))
+	q.Append("( version bigint not null, name text not null, checksum text not null,",
+		"applied_at timestamp (6) without time zone not null, duration bigint not null,")
+	q.Appendf("CONSTRAINT %v PRIMARY KEY (version) )", mustIdentifier(toSnake(MigrationsTable, "pk")))
+
+	return p.execDDL(ctx, q.String(), fmt.Sprintf("table %v does not exist", MigrationsTable))
+}
+
+// applyMigration runs the migration and records it in the same transaction
+func (p *Postgres) applyMigration(ctx context.Context, m *migration) error {
+	if p.plan != nil {
+		p.plan.steps = append(p.plan.steps, MigrationStep{SQL: formatQuery(m.upSQL), Reason: fmt.Sprintf("migration %v is not applied", m)})
+		return nil
+	}
+
+	return p.TransactionContext(ctx, func(tx *Transaction) error {
+		start := time.Now()
+		if _, err := tx.Exec(ctx, m.upSQL); err != nil {
+			return err
+		}
+		duration := time.Since(start)
+
+		queryf := "INSERT INTO %v (version, name, checksum, applied_at, duration) VALUES ($1, $2, $3, $4, $5)"
+		query := fmt.Sprintf(queryf, mustIdentifier(MigrationsTable))
+		_, err := tx.Exec(ctx, query, m.version, m.name, m.checksum(), start.UTC(), duration.Nanoseconds())
+		return err
+	})
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMigrationFilename(t *testing.T) {
+	version, name, ok := parseMigrationFilename("0001_add_users.sql")
+	require.True(t, ok)
+	require.Equal(t, int64(1), version)
+	require.Equal(t, "add_users", name)
+
+	_, _, ok = parseMigrationFilename("add_users.sql")
+	require.False(t, ok)
+
+	_, _, ok = parseMigrationFilename("0001_add_users.txt")
+	require.False(t, ok)
+}
+
+func TestLoadMigrations(t *testing.T) {
+	ms, err := loadMigrations(http.Dir("test_data/migrations"))
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+
+	require.Equal(t, "1_create_foo", ms[0].String())
+	require.Equal(t, "CREATE TABLE foo (id int);\n", ms[0].upSQL)
+	require.Equal(t, "2_insert_foo", ms[1].String())
+}
+
+func TestRegisterMigrations_Invalid(t *testing.T) {
+	// nothing is registered if one migration is invalid
+	require.Error(t, registerMigrations(
+		&migration{version: 9001, name: "foo"},
+		&migration{version: 9001, name: "bar"}))
+
+	require.Error(t, registerMigrations(
+		&migration{version: 9002, name: "foo"},
+		&migration{version: 0, name: "bar"}))
+
+	for _, m := range registeredMigrations() {
+		require.NotContains(t, []int64{9001, 9002}, m.version)
+	}
+}
+
+func TestEnsureMigrations(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// temporary tables only exist on one connection
+	db.SetMaxOpenConns(1)
+
+	ms := []*migration{
+		{version: 1, name: "create", upSQL: "CREATE TEMPORARY TABLE test_ensure_migrations (id int)"},
+		{version: 2, name: "insert", upSQL: "INSERT INTO test_ensure_migrations VALUES (1), (2)"},
+	}
+	require.NoError(t, db.ensureMigrations(context.Background(), ms))
+
+	var n int
+	require.NoError(t, db.QueryRow(context.Background(), "SELECT count(*) FROM test_ensure_migrations").Scan(&n))
+	require.Equal(t, 2, n)
+
+	applied, err := db.appliedMigrations(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, map[int64]string{1: ms[0].checksum(), 2: ms[1].checksum()}, applied)
+
+	// migrations were already applied
+	require.NoError(t, db.ensureMigrations(context.Background(), ms))
+	require.NoError(t, db.QueryRow(context.Background(), "SELECT count(*) FROM test_ensure_migrations").Scan(&n))
+	require.Equal(t, 2, n)
+
+	// applied migrations must not change
+	ms[1].upSQL = "INSERT INTO test_ensure_migrations VALUES (3)"
+	require.Error(t, db.ensureMigrations(context.Background(), ms))
+
+	// failed migrations are not recorded
+	ms = append(ms[:1], &migration{version: 3, name: "fail", upSQL: "SELECT foo FROM bar"})
+	require.Error(t, db.ensureMigrations(context.Background(), ms))
+	applied, err = db.appliedMigrations(context.Background())
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+}
@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// Iterator iterates over the records found by FilterIter.
+// It decodes one record at a time and must be closed when done.
+type Iterator struct {
+	rows *sql.Rows
+	typ  reflect.Type
+}
+
+// Next prepares the next record for reading with Scan. It returns false
+// if there are no more records or if an error occurred, see Err.
+func (i *Iterator) Next() bool {
+	return i.rows.Next()
+}
+
+// Scan decodes the current record into s, which must be a pointer
+// to the same struct type that was given to FilterIter.
+func (i *Iterator) Scan(s Struct) error {
+	if !isPointer(s) {
+		panic(fmt.Sprintf("expect *%T not %T", s, s))
+	}
+
+	if typeOf(s) != i.typ {
+		panic(fmt.Sprintf("expect *%v not %T", i.typ, s))
+	}
+
+	return mustNewFields(s, false).Scan(i.rows)
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (i *Iterator) Err() error {
+	return i.rows.Err()
+}
+
+// Close closes the Iterator and releases its database connection.
+// Close is called automatically if Next returns false.
+func (i *Iterator) Close() error {
+	return i.rows.Close()
+}
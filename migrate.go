@@ -0,0 +1,382 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// errTableDoesNotExist is returned by describeTable for offline migration plans
+var errTableDoesNotExist = &pq.Error{Code: "42P01"}
+
+// MigrationStep is a single SQL statement that Migrate would execute.
+type MigrationStep struct {
+	// SQL is the statement as it would be executed
+	SQL string
+
+	// Reason explains why the statement is required
+	Reason string
+}
+
+// MigrateOptions configures MigrateWithOptions.
+type MigrateOptions struct {
+	// AllowDestructive must be set for Drop to take effect.
+	AllowDestructive bool
+
+	// Drop lists per struct what may be dropped.
+	Drop []Drop
+}
+
+// Drop is an allowlist of columns, indexes and foreign keys that may be
+// dropped from a struct's table. Names are database names, as reported by Drift.
+// Listing anything that is still described by the struct is an error.
+type Drop struct {
+	// Struct is a registered struct, i.e. &User{}
+	Struct Struct
+
+	Columns     []string
+	Indexes     []string
+	ForeignKeys []string
+}
+
+type registeredDrop struct {
+	Drop
+	r *metaStruct
+}
+
+// drops validates Drop against registered structs before anything is migrated
+func (o MigrateOptions) drops() ([]registeredDrop, error) {
+	if len(o.Drop) > 0 && !o.AllowDestructive {
+		return nil, fmt.Errorf("Drop requires AllowDestructive")
+	}
+
+	out := make([]registeredDrop, 0, len(o.Drop))
+	for _, d := range o.Drop {
+		if d.Struct == nil {
+			return nil, fmt.Errorf("Drop: struct is nil")
+		}
+
+		r, ok := registeredStruct(d.Struct)
+		if !ok {
+			return nil, fmt.Errorf("Drop: struct %T is not registered", d.Struct)
+		}
+
+		for _, name := range d.Columns {
+			if r.fields.hasColumnName(name) {
+				return nil, fmt.Errorf("Drop: column %v is still used by struct %T", name, d.Struct)
+			}
+		}
+
+		for _, name := range d.Indexes {
+			for _, x := range r.expectedIndexes() {
+				if toSnake(x.Name) == toSnake(name) {
+					return nil, fmt.Errorf("Drop: index %v is still used by struct %T", name, d.Struct)
+				}
+			}
+		}
+
+		for _, name := range d.ForeignKeys {
+			if stringSliceContains(r.foreignKeyNames(), toSnake(name)) {
+				return nil, fmt.Errorf("Drop: foreign key %v is still used by struct %T", name, d.Struct)
+			}
+		}
+
+		out = append(out, registeredDrop{Drop: d, r: r})
+	}
+
+	return out, nil
+}
+
+// MigratePlan compares registered structs with the database, just like
+// Migrate, but returns the ordered SQL statements instead of executing them.
+// Running Migrate afterwards executes exactly these statements, unless the
+// database changed in the meantime.
+func (p *Postgres) MigratePlan(ctx context.Context) ([]MigrationStep, error) {
+	return p.MigratePlanWithOptions(ctx, MigrateOptions{})
+}
+
+// MigratePlanWithOptions returns the SQL statements MigrateWithOptions would
+// execute with the same opts, including drops.
+func (p *Postgres) MigratePlanWithOptions(ctx context.Context, opts MigrateOptions) ([]MigrationStep, error) {
+	drops, err := opts.drops()
+	if err != nil {
+		return nil, err
+	}
+
+	px, err := p.clone()
+	if err != nil {
+		return nil, err
+	}
+	defer px.Close()
+
+	px.plan = newMigrationPlan()
+
+	if err := px.runMigrations(ctx, registeredStructs(), registeredMigrations(), drops); err != nil {
+		return nil, err
+	}
+
+	return px.plan.steps, nil
+}
+
+// DumpSchema writes the SQL statements that Migrate executes on an empty
+// database for all registered structs to w, i.e. to review the schema
+// or check it into a repository. It doesn't require a connection.
+// Versioned migrations are not included.
+func DumpSchema(w io.Writer) error {
+	return dumpSchema(w, registeredStructs())
+}
+
+// DumpSchema writes the SQL statements for all registered structs to w.
+// It does not look at the database, see package-level DumpSchema.
+func (p *Postgres) DumpSchema(w io.Writer) error {
+	return DumpSchema(w)
+}
+
+func dumpSchema(w io.Writer, rs []*metaStruct) error {
+	p := &Postgres{plan: newMigrationPlan()}
+	p.plan.offline = true
+
+	for _, r := range rs {
+		if err := p.ensureTable(context.Background(), r); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range rs {
+		if err := p.ensureForeignKeys(context.Background(), r); err != nil {
+			return err
+		}
+	}
+
+	for _, step := range p.plan.steps {
+		if _, err := fmt.Fprintf(w, "%v;\n\n", step.SQL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureDropped drops foreign keys, indexes and columns listed in d,
+// if they still exist. d must be validated by MigrateOptions.drops.
+func (p *Postgres) ensureDropped(ctx context.Context, r *metaStruct, d Drop) error {
+	tbl, err := p.describeTable(ctx, toSnake(r.name))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range d.ForeignKeys {
+		exists, err := p.constraintExists(ctx, toSnake(name))
+		if err != nil {
+			return err
+		}
+		if exists {
+			if err := p.dropConstraint(ctx, toSnake(r.name), toSnake(name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range d.Indexes {
+		if tbl.hasIndexByName(name) {
+			if err := p.dropIndex(ctx, toSnake(name), !r.fields.hasPartitionedField()); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range d.Columns {
+		if tbl.hasColumnByName(name) {
+			if err := p.dropColumn(ctx, toSnake(r.name), toSnake(name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// safeTypeChanges are widening conversions that Migrate applies automatically.
+// Keys are the current and the expected data type as reported by
+// information_schema.columns, values are USING expressions for the column.
+var safeTypeChanges = map[[2]string]string{
+	{"smallint", "integer"}:       "%v::integer",
+	{"smallint", "bigint"}:        "%v::bigint",
+	{"integer", "bigint"}:         "%v::bigint",
+	{"character varying", "text"}: "%v::text",
+	{"text", "jsonb"}:             "NULLIF(%v, '')::jsonb",
+}
+
+// checkedTypeChanges are safe type changes that fail for some values,
+// i.e. text that isn't valid JSON. Existing rows are checked first.
+var checkedTypeChanges = map[[2]string]bool{
+	{"text", "jsonb"}: true,
+}
+
+// safeTypeChange returns the USING expression to convert a column
+// from one data type to another, if the conversion is safe.
+func safeTypeChange(from, to string) (using string, ok bool) {
+	using, ok = safeTypeChanges[[2]string{strings.ToLower(from), strings.ToLower(to)}]
+	return using, ok
+}
+
+// canChangeColumnType returns false if converting the column's values
+// with the USING expression fails for at least one row.
+func (p *Postgres) canChangeColumnType(ctx context.Context, tableName, columnName, using string) (bool, error) {
+	query := fmt.Sprintf("SELECT count(*) FROM %v WHERE %v IS NOT NULL", mustIdentifier(tableName), fmt.Sprintf(using, mustIdentifier(columnName)))
+
+	var n int64
+	err := p.QueryRow(ctx, query).Scan(&n)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Class() == "22" {
+		return false, nil // data_exception, i.e. invalid_text_representation
+	}
+	return err == nil, err
+}
+
+// execDDL executes a DDL statement, or records it if a migration plan is in progress.
+func (p *Postgres) execDDL(ctx context.Context, query, reason string) error {
+	if p.plan != nil {
+		p.plan.steps = append(p.plan.steps, MigrationStep{SQL: formatQuery(query), Reason: reason})
+		return nil
+	}
+
+	_, err := p.Exec(ctx, query)
+	return err
+}
+
+// migrationPlan records planned statements and keeps track of the
+// tables, columns, indexes and constraints they would create, so
+// that later comparisons see the database as if they had been executed.
+type migrationPlan struct {
+	steps       []MigrationStep
+	tables      map[string]*table
+	constraints map[string]bool
+
+	// offline plans run without a database, as if it was empty
+	offline bool
+
+	// renamedColumns are old column names, keyed by table name
+	renamedColumns map[string][]string
+
+	// checks are added check constraints by name, keyed by table name
+	checks map[string]map[string]check
+}
+
+func newMigrationPlan() *migrationPlan {
+	return &migrationPlan{
+		tables:         make(map[string]*table),
+		constraints:    make(map[string]bool),
+		renamedColumns: make(map[string][]string),
+		checks:         make(map[string]map[string]check),
+	}
+}
+
+func (m *migrationPlan) table(tableName string) *table {
+	tableName = toSnake(tableName)
+	if _, ok := m.tables[tableName]; !ok {
+		m.tables[tableName] = &table{Name: tableName}
+	}
+	return m.tables[tableName]
+}
+
+func (m *migrationPlan) createTable(r *metaStruct) {
+	t := m.table(r.name)
+	for _, f := range r.fields {
+		t.Columns = append(t.Columns, column{Name: toSnake(f.name), DataType: f.columnType()})
+	}
+
+	if primaryNames := r.fields.primaryNames(); len(primaryNames) > 0 {
+		t.Indexes = append(t.Indexes, index{
+			Name:      toSnake(r.name, "pk"),
+			Type:      "btree",
+			Columns:   stringSliceToSnake(primaryNames),
+			IsUnique:  true,
+			IsPrimary: true,
+		})
+		m.constraints[toSnake(r.name, "pk")] = true
+	}
+}
+
+func (m *migrationPlan) addColumn(tableName, columnName, dataType string) {
+	t := m.table(tableName)
+	t.Columns = append(t.Columns, column{Name: toSnake(columnName), DataType: dataType})
+}
+
+func (m *migrationPlan) renameColumn(tableName, oldColumnName, newColumnName string) {
+	t := m.table(tableName)
+	t.Columns = append(t.Columns, column{Name: toSnake(newColumnName)})
+	m.renamedColumns[t.Name] = append(m.renamedColumns[t.Name], toSnake(oldColumnName))
+}
+
+func (m *migrationPlan) createIndex(indexName, tableName string, columns []string, unique bool, tag indexStructTag) {
+	x := newIndex(toSnake(indexName), stringSliceToSnake(columns), tag)
+	x.IsUnique = postgresBool(unique)
+
+	t := m.table(tableName)
+	t.Indexes = append(t.Indexes, x)
+}
+
+func (m *migrationPlan) addPrimaryKey(tableName, constraintName, indexName string) {
+	t := m.table(tableName)
+	for i := range t.Indexes {
+		if t.Indexes[i].Name == toSnake(indexName) {
+			t.Indexes[i].IsPrimary = true
+		}
+	}
+	m.constraints[toSnake(constraintName)] = true
+}
+
+func (m *migrationPlan) addForeignKey(constraintName string) {
+	m.constraints[toSnake(constraintName)] = true
+}
+
+func (m *migrationPlan) addCheck(tableName, constraintName string, notValid bool) {
+	tableName = toSnake(tableName)
+	if _, ok := m.checks[tableName]; !ok {
+		m.checks[tableName] = make(map[string]check)
+	}
+	m.checks[tableName][toSnake(constraintName)] = check{Validated: !notValid}
+}
+
+// describeTable merges planned changes into tbl, which is nil
+// if the table doesn't exist in the database yet.
+func (m *migrationPlan) describeTable(tableName string, tbl *table) (*table, bool) {
+	planned, ok := m.tables[toSnake(tableName)]
+	if !ok {
+		return tbl, tbl != nil
+	}
+
+	out := &table{Name: tableName}
+	if tbl != nil {
+		for _, c := range tbl.Columns {
+			if !stringSliceContains(m.renamedColumns[planned.Name], c.Name) {
+				out.Columns = append(out.Columns, c)
+			}
+		}
+		out.Indexes = append(out.Indexes, tbl.Indexes...)
+	}
+
+	for _, c := range planned.Columns {
+		if !out.hasColumnByName(c.Name) {
+			out.Columns = append(out.Columns, c)
+		}
+	}
+
+	for _, x := range planned.Indexes {
+		found := false
+		for _, i := range out.Indexes {
+			if strings.EqualFold(i.Name, x.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out.Indexes = append(out.Indexes, x)
+		}
+	}
+
+	return out, true
+}
@@ -0,0 +1,307 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type TestMigratePlan_StructA struct {
+	Id    string `db:"pk"`
+	Email string `db:"unique"`
+}
+
+type TestMigratePlan_StructB struct {
+	Id  string `db:"pk"`
+	AId string `db:"references(struct=TestMigratePlan_StructA, field=Id)"`
+}
+
+func TestMigratePlan(t *testing.T) {
+	Register(&TestMigratePlan_StructA{}, "")
+	Register(&TestMigratePlan_StructB{}, "")
+
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	steps, err := db.MigratePlan(context.Background())
+	require.NoError(t, err)
+
+	// only look at steps for this test's structs
+	out := make([]MigrationStep, 0)
+	for _, s := range steps {
+		if strings.Contains(s.SQL, "test_migrate_plan_") {
+			out = append(out, s)
+		}
+	}
+
+	expect := []MigrationStep{
+		{
+			SQL:    `CREATE TEMPORARY TABLE IF NOT EXISTS "test_migrate_plan_struct_a" ( "id" text not null default '', "email" text not null default '' , CONSTRAINT "test_migrate_plan_struct_a_pk" PRIMARY KEY ("id") )`,
+			Reason: "table test_migrate_plan_struct_a does not exist",
+		},
+		{
+			SQL:    `CREATE UNIQUE INDEX CONCURRENTLY "test_migrate_plan_struct_a_email_unique" ON "test_migrate_plan_struct_a" ("email")`,
+			Reason: "index test_migrate_plan_struct_a_email_unique does not exist",
+		},
+		{
+			SQL:    `CREATE TEMPORARY TABLE IF NOT EXISTS "test_migrate_plan_struct_b" ( "id" text not null default '', "a_id" text not null default '' , CONSTRAINT "test_migrate_plan_struct_b_pk" PRIMARY KEY ("id") )`,
+			Reason: "table test_migrate_plan_struct_b does not exist",
+		},
+		{
+			SQL:    `ALTER TABLE "test_migrate_plan_struct_b" ADD CONSTRAINT "test_migrate_plan_struct_b_a_id_fk" FOREIGN KEY ("a_id") REFERENCES "test_migrate_plan_struct_a" ("id") MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE`,
+			Reason: "foreign key test_migrate_plan_struct_b_a_id_fk does not exist",
+		},
+	}
+	require.Equal(t, expect, out)
+
+	// nothing was executed
+	_, err = db.describeTable(context.Background(), "test_migrate_plan_struct_a")
+	require.True(t, isErrTableDoesNotExist(err))
+}
+
+func TestMigrationPlan_DescribeTable(t *testing.T) {
+	m := newMigrationPlan()
+
+	// table doesn't exist and is not planned
+	_, ok := m.describeTable("foo", nil)
+	require.False(t, ok)
+
+	// planned changes are merged into existing table
+	m.addColumn("foo", "Col2", "text")
+	m.createIndex("foo_col2_unique", "foo", []string{"Col2"}, true, indexStructTag{})
+	m.addForeignKey("foo_col2_fk")
+
+	tbl, ok := m.describeTable("foo", &table{Name: "foo", Columns: []column{{Name: "col1"}}})
+	require.True(t, ok)
+	require.True(t, tbl.hasColumnByName("Col1"))
+	require.True(t, tbl.hasColumnByName("Col2"))
+	require.True(t, tbl.hasUniqueIndexByColumns([]string{"Col2"}))
+	require.True(t, m.constraints["foo_col2_fk"])
+
+	// renamed columns replace the old column
+	m.renameColumn("foo", "col1", "col3")
+	tbl, ok = m.describeTable("foo", &table{Name: "foo", Columns: []column{{Name: "col1"}}})
+	require.True(t, ok)
+	require.False(t, tbl.hasColumnByName("Col1"))
+	require.True(t, tbl.hasColumnByName("Col3"))
+}
+
+type TestMigrationPlan_Check_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 int    `db:"check(expr='col2 >= 0')"`
+}
+
+func TestMigrationPlan_Check(t *testing.T) {
+	p := &Postgres{plan: newMigrationPlan()}
+	p.plan.offline = true
+
+	// planned checks are added as NOT VALID and validated afterwards
+	r := mustNewMetaStruct(&TestMigrationPlan_Check_Struct{})
+	require.NoError(t, p.ensureChecks(context.Background(), r))
+	require.NoError(t, p.validateChecks(context.Background(), r))
+	require.Equal(t, []MigrationStep{
+		{
+			SQL:    `ALTER TABLE "test_migration_plan_check_struct" ADD CONSTRAINT "test_migration_plan_check_struct_col2_check" CHECK (col2 >= 0) NOT VALID`,
+			Reason: "check test_migration_plan_check_struct_col2_check does not exist",
+		},
+		{
+			SQL:    `ALTER TABLE "test_migration_plan_check_struct" VALIDATE CONSTRAINT "test_migration_plan_check_struct_col2_check"`,
+			Reason: "check test_migration_plan_check_struct_col2_check is not validated",
+		},
+	}, p.plan.steps)
+}
+
+type TestMigrateOptions_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 string `db:"index"`
+}
+
+func TestMigrateOptions_Drops(t *testing.T) {
+	Register(&TestMigrateOptions_Struct{}, "")
+
+	_, err := MigrateOptions{}.drops()
+	require.NoError(t, err)
+
+	// AllowDestructive is required
+	_, err = MigrateOptions{Drop: []Drop{{Struct: &TestMigrateOptions_Struct{}, Columns: []string{"col3"}}}}.drops()
+	require.Error(t, err)
+
+	drops, err := MigrateOptions{AllowDestructive: true, Drop: []Drop{{Struct: &TestMigrateOptions_Struct{}, Columns: []string{"col3"}}}}.drops()
+	require.NoError(t, err)
+	require.Len(t, drops, 1)
+
+	// struct must be registered
+	_, err = MigrateOptions{AllowDestructive: true, Drop: []Drop{{Struct: &TestEnsureDropped_Struct{}}}}.drops()
+	require.Error(t, err)
+
+	// anything still used by the struct can't be dropped
+	_, err = MigrateOptions{AllowDestructive: true, Drop: []Drop{{Struct: &TestMigrateOptions_Struct{}, Columns: []string{"Col2"}}}}.drops()
+	require.Error(t, err)
+	_, err = MigrateOptions{AllowDestructive: true, Drop: []Drop{{Struct: &TestMigrateOptions_Struct{}, Indexes: []string{"test_migrate_options_struct_col2_index"}}}}.drops()
+	require.Error(t, err)
+	_, err = MigrateOptions{AllowDestructive: true, Drop: []Drop{{Struct: &TestMigrateOptions_Struct{}, Indexes: []string{"test_migrate_options_struct_pk"}}}}.drops()
+	require.Error(t, err)
+}
+
+type TestEnsureDropped_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 string
+}
+
+func TestEnsureDropped(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	r := mustNewMetaStruct(&TestEnsureDropped_Struct{})
+	require.NoError(t, db.ensureTable(context.Background(), r))
+
+	// add a column and index that are no longer part of the struct
+	_, err = db.Exec(context.Background(), `ALTER TABLE test_ensure_dropped_struct ADD COLUMN col3 text`)
+	require.NoError(t, err)
+	_, err = db.Exec(context.Background(), `CREATE INDEX test_ensure_dropped_struct_col3_index ON test_ensure_dropped_struct (col3)`)
+	require.NoError(t, err)
+
+	d := Drop{
+		Columns: []string{"col3"},
+		Indexes: []string{"test_ensure_dropped_struct_col3_index"},
+	}
+	require.NoError(t, db.ensureDropped(context.Background(), r, d))
+
+	tbl, err := db.describeTable(context.Background(), "test_ensure_dropped_struct")
+	require.NoError(t, err)
+	require.False(t, tbl.hasColumnByName("col3"))
+	require.False(t, tbl.hasIndexByName("test_ensure_dropped_struct_col3_index"))
+
+	// already dropped
+	log := &testLogger{}
+	db.Logger = log
+	require.NoError(t, db.ensureDropped(context.Background(), r, d))
+	require.NotContains(t, log.writer.String(), "DROP")
+}
+
+type TestMigratePlanWithOptions_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 string
+}
+
+func TestMigratePlanWithOptions(t *testing.T) {
+	Register(&TestMigratePlanWithOptions_Struct{}, "")
+
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestMigratePlanWithOptions_Struct{})))
+	_, err = db.Exec(context.Background(), `ALTER TABLE test_migrate_plan_with_options_struct ADD COLUMN col3 text`)
+	require.NoError(t, err)
+
+	// AllowDestructive is required, just like for MigrateWithOptions
+	opts := MigrateOptions{Drop: []Drop{{Struct: &TestMigratePlanWithOptions_Struct{}, Columns: []string{"col3"}}}}
+	_, err = db.MigratePlanWithOptions(context.Background(), opts)
+	require.Error(t, err)
+
+	opts.AllowDestructive = true
+	steps, err := db.MigratePlanWithOptions(context.Background(), opts)
+	require.NoError(t, err)
+	require.Contains(t, steps, MigrationStep{
+		SQL:    `ALTER TABLE "test_migrate_plan_with_options_struct" DROP COLUMN IF EXISTS "col3"`,
+		Reason: "column test_migrate_plan_with_options_struct.col3 is not used by struct",
+	})
+
+	// nothing was dropped
+	tbl, err := db.describeTable(context.Background(), "test_migrate_plan_with_options_struct")
+	require.NoError(t, err)
+	require.True(t, tbl.hasColumnByName("col3"))
+}
+
+func TestSafeTypeChange(t *testing.T) {
+	using, ok := safeTypeChange("integer", "bigint")
+	require.True(t, ok)
+	require.Equal(t, `"col"::bigint`, fmt.Sprintf(using, mustIdentifier("col")))
+
+	_, ok = safeTypeChange("bigint", "integer")
+	require.False(t, ok)
+
+	_, ok = safeTypeChange("text", "integer")
+	require.False(t, ok)
+}
+
+type TestDumpSchema_StructA struct {
+	Id    string `db:"pk"`
+	Email string `db:"unique(expr='lower(email)')"`
+}
+
+type TestDumpSchema_StructB struct {
+	Id        string    `db:"pk"`
+	AId       string    `db:"references(struct=TestDumpSchema_StructA, field=Id)"`
+	CreatedAt time.Time `db:"index(order=desc)"`
+}
+
+func TestDumpSchema(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, dumpSchema(buf, []*metaStruct{
+		mustNewMetaStruct(&TestDumpSchema_StructA{}),
+		mustNewMetaStruct(&TestDumpSchema_StructB{}),
+	}))
+
+	expect, err := ioutil.ReadFile("test_data/test_dump_schema.sql")
+	require.NoError(t, err)
+	require.Equal(t, string(expect), buf.String())
+}
+
+type TestDumpSchema_ForeignKeyOptions_StructA struct {
+	Id      string `db:"pk(composite=[Version])"`
+	Version int
+}
+
+type TestDumpSchema_ForeignKeyOptions_StructB struct {
+	Id        string `db:"pk"`
+	AId       string `db:"references(struct=TestDumpSchema_ForeignKeyOptions_StructA, fields=[Id, Version], composite=[AVersion], onDelete=restrict, deferrable=true)"`
+	AVersion  int
+	ParentId  sql.NullString `db:"references(struct=TestDumpSchema_ForeignKeyOptions_StructB, field=Id, onDelete=\"set null\")"`
+	SiblingId string         `db:"references(struct=TestDumpSchema_ForeignKeyOptions_StructB, field=Id, onDelete=\"set null\")"`
+}
+
+func TestDumpSchema_ForeignKeyOptions(t *testing.T) {
+	a := mustNewMetaStruct(&TestDumpSchema_ForeignKeyOptions_StructA{})
+	b := mustNewMetaStruct(&TestDumpSchema_ForeignKeyOptions_StructB{})
+	b.fields = b.fields[:4] // without SiblingId
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, dumpSchema(buf, []*metaStruct{a, b}))
+	require.Contains(t, buf.String(), `ALTER TABLE "test_dump_schema_foreign_key_options_struct_b" ADD CONSTRAINT "test_dump_schema_foreign_key_options_struct_b_a_id_fk" FOREIGN KEY ("a_id", "a_version") REFERENCES "test_dump_schema_foreign_key_options_struct_a" ("id", "version") MATCH SIMPLE ON DELETE RESTRICT ON UPDATE CASCADE DEFERRABLE;`)
+	require.Contains(t, buf.String(), `ALTER TABLE "test_dump_schema_foreign_key_options_struct_b" ADD CONSTRAINT "test_dump_schema_foreign_key_options_struct_b_parent_id_fk" FOREIGN KEY ("parent_id") REFERENCES "test_dump_schema_foreign_key_options_struct_b" ("id") MATCH SIMPLE ON DELETE SET NULL ON UPDATE CASCADE;`)
+
+	// set null requires a nullable column
+	b = mustNewMetaStruct(&TestDumpSchema_ForeignKeyOptions_StructB{})
+	require.Error(t, dumpSchema(&bytes.Buffer{}, []*metaStruct{a, b}))
+}
+
+type TestDumpSchema_Check_Struct struct {
+	Id     string `db:"pk"`
+	Amount int    `db:"check(expr='amount >= 0'), check(name=amount_max, expr='amount <= 100')"`
+	Status string `db:"check(expr=\"status IN ('open', 'closed')\")"`
+}
+
+type TestDumpSchema_Check_StructDuplicate struct {
+	Id     string `db:"pk"`
+	Amount int    `db:"check(name=foo, expr='amount >= 0')"`
+	Status string `db:"check(name=Foo, expr='length(status) > 0')"`
+}
+
+func TestDumpSchema_Check(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, dumpSchema(buf, []*metaStruct{mustNewMetaStruct(&TestDumpSchema_Check_Struct{})}))
+	require.Equal(t, `CREATE TABLE IF NOT EXISTS "test_dump_schema_check_struct" ( "id" text not null default '', "amount" integer not null default 0, "status" text not null default '' , CONSTRAINT "test_dump_schema_check_struct_pk" PRIMARY KEY ("id") , CONSTRAINT "test_dump_schema_check_struct_amount_check" CHECK (amount >= 0) , CONSTRAINT "test_dump_schema_check_struct_amount_max" CHECK (amount <= 100) , CONSTRAINT "test_dump_schema_check_struct_status_check" CHECK (status IN ('open', 'closed')) );
+
+`, buf.String())
+
+	_, err := newMetaStruct(&TestDumpSchema_Check_StructDuplicate{})
+	require.EqualError(t, err, "check Foo is declared twice")
+}
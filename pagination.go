@@ -0,0 +1,202 @@
+package postgres
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PageTokenSecret is used to sign page tokens, so that tokens can be
+// handed to untrusted clients. It defaults to a random secret, which only
+// works within a single process. Set it to the same value for all processes
+// that should accept each other's page tokens.
+var PageTokenSecret []byte
+
+// ErrInvalidPageToken is returned if a page token was tampered with
+// or doesn't match the query it is used with.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+func init() {
+	PageTokenSecret = make([]byte, 32)
+	if _, err := rand.Read(PageTokenSecret); err != nil {
+		panic(err)
+	}
+}
+
+// After instructs the query to return results after the given page token,
+// as returned by NextPageToken. An empty token starts at the first page.
+//
+// Results are ordered by the fields given to Asc and Desc, followed by the
+// primary keys of the struct. Fields used for ordering must not be null.
+func (q *QueryStmt) After(token string) *QueryStmt {
+	q.paginate = true
+	q.after = token
+	return q
+}
+
+// NextPageToken returns the page token for the next page of results,
+// after the query was used with Filter and After. It returns an empty
+// string if there are no more results.
+func (q *QueryStmt) NextPageToken() string {
+	return q.nextPageToken
+}
+
+// keysetOrder returns the order fields with the primary keys appended,
+// so that records are in a stable order across pages.
+func (q *QueryStmt) keysetOrder(r *metaStruct) []orderField {
+	order := make([]orderField, 0, len(q.order))
+	order = append(order, q.order...)
+
+	for _, name := range r.fields.primaryNames() {
+		found := false
+		for _, o := range order {
+			if toSnake(o.name) == toSnake(name) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			order = append(order, orderField{name: name})
+		}
+	}
+
+	return order
+}
+
+// keysetStr returns the condition to select records after the given values,
+// where values are in the same order as the order fields. Placeholders start
+// after offset.
+func keysetStr(order []orderField, offset int) string {
+	or := make([]string, 0, len(order))
+	for i := 0; i < len(order); i++ {
+		and := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, fmt.Sprintf("%v = $%v", mustIdentifier(order[j].name), offset+j+1))
+		}
+
+		operator := ">"
+		if order[i].desc {
+			operator = "<"
+		}
+		and = append(and, fmt.Sprintf("%v %v $%v", mustIdentifier(order[i].name), operator, offset+i+1))
+
+		or = append(or, "("+strings.Join(and, " AND ")+")")
+	}
+
+	return "(" + strings.Join(or, " OR ") + ")"
+}
+
+// encodePageToken returns a signed page token for the given record fields.
+func encodePageToken(r *metaStruct, order []orderField, f fields) (string, error) {
+	values := make([]string, 0, len(order))
+	for _, o := range order {
+		x := f.findByName(o.name)
+		if x == nil {
+			return "", fmt.Errorf("page token: unknown field %v", o.name)
+		}
+
+		v, err := pageTokenValue(x)
+		if err != nil {
+			return "", err
+		}
+		values = append(values, v)
+	}
+
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signPageToken(r, order, payload)), nil
+}
+
+// decodePageToken verifies a page token and returns its values.
+func decodePageToken(r *metaStruct, order []orderField, token string) ([]interface{}, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidPageToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	if !hmac.Equal(signature, signPageToken(r, order, payload)) {
+		return nil, ErrInvalidPageToken
+	}
+
+	values := make([]string, 0, len(order))
+	if err := json.Unmarshal(payload, &values); err != nil {
+		return nil, ErrInvalidPageToken
+	}
+
+	if len(values) != len(order) {
+		return nil, ErrInvalidPageToken
+	}
+
+	out := make([]interface{}, len(values))
+	for i := 0; i < len(values); i++ {
+		out[i] = values[i]
+	}
+	return out, nil
+}
+
+// signPageToken signs the payload together with the table and order,
+// so a token can't be used for a different query.
+func signPageToken(r *metaStruct, order []orderField, payload []byte) []byte {
+	mac := hmac.New(sha256.New, PageTokenSecret)
+	mac.Write([]byte(r.alias()))
+	mac.Write([]byte{0})
+	mac.Write([]byte(orderStr(order)))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// pageTokenValue returns the text representation of a field's value,
+// which Postgres casts back to the column type.
+func pageTokenValue(f *field) (string, error) {
+	v, err := f.Value()
+	if err != nil {
+		return "", err
+	}
+
+	switch x := v.(type) {
+	case nil:
+		return "", fmt.Errorf("page token: field %v is null", f.name)
+
+	case time.Time:
+		return x.Format(time.RFC3339Nano), nil
+
+	case []byte:
+		return string(x), nil
+
+	case string:
+		return x, nil
+
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64), nil
+
+	case bool:
+		return strconv.FormatBool(x), nil
+	}
+
+	return fmt.Sprintf("%v", v), nil
+}
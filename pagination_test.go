@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeysetStr(t *testing.T) {
+	order := []orderField{{name: "Col1"}, {name: "Col2", desc: true}, {name: "Id"}}
+	require.Equal(t,
+		`(("col1" > $3) OR ("col1" = $3 AND "col2" < $4) OR ("col1" = $3 AND "col2" = $4 AND "id" > $5))`,
+		keysetStr(order, 2))
+}
+
+type TestPageToken_Struct struct {
+	Id        string `db:"pk"`
+	Count     int
+	CreatedAt time.Time
+}
+
+func TestKeysetOrder(t *testing.T) {
+	r := mustNewMetaStruct(&TestPageToken_Struct{})
+
+	require.Equal(t, []orderField{{name: "Count", desc: true}, {name: "Id"}},
+		Query("").Desc("Count").keysetOrder(r))
+
+	// primary key is not added twice
+	require.Equal(t, []orderField{{name: "Id", desc: true}},
+		Query("").Desc("Id").keysetOrder(r))
+}
+
+func TestPageToken(t *testing.T) {
+	r := mustNewMetaStruct(&TestPageToken_Struct{})
+	order := Query("").Desc("CreatedAt").Asc("Count").keysetOrder(r)
+
+	s := &TestPageToken_Struct{
+		Id:        "abc",
+		Count:     5,
+		CreatedAt: time.Date(2019, 10, 1, 12, 30, 0, 123456000, time.UTC),
+	}
+
+	token, err := encodePageToken(r, order, mustNewFields(s, false))
+	require.NoError(t, err)
+
+	values, err := decodePageToken(r, order, token)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"2019-10-01T12:30:00.123456Z", "5", "abc"}, values)
+
+	// token was tampered with
+	_, err = decodePageToken(r, order, "x"+token)
+	require.Equal(t, ErrInvalidPageToken, err)
+
+	_, err = decodePageToken(r, order, token+"x")
+	require.Equal(t, ErrInvalidPageToken, err)
+
+	_, err = decodePageToken(r, order, "")
+	require.Equal(t, ErrInvalidPageToken, err)
+
+	// token is used with a different order
+	_, err = decodePageToken(r, Query("").Asc("Count").keysetOrder(r), token)
+	require.Equal(t, ErrInvalidPageToken, err)
+}
+
+func TestFilterQuery_After(t *testing.T) {
+	r := mustNewMetaStruct(&TestPageToken_Struct{})
+
+	// first page
+	q := Query("Count > $1", 1).Desc("Count").Limit(2).After("")
+	query, args, err := filterQuery(r, q, true)
+	require.NoError(t, err)
+	require.Equal(t, `SELECT "id", "count", "created_at" FROM "test_page_token_struct" WHERE Count > $1 ORDER BY "count" DESC, "id" ASC LIMIT 2`, query)
+	require.Equal(t, []interface{}{1}, args)
+
+	// next page
+	token, err := encodePageToken(r, q.keysetOrder(r), mustNewFields(&TestPageToken_Struct{Id: "abc", Count: 5}, false))
+	require.NoError(t, err)
+
+	q = Query("Count > $1", 1).Desc("Count").Limit(2).After(token)
+	query, args, err = filterQuery(r, q, true)
+	require.NoError(t, err)
+	require.Equal(t, `SELECT "id", "count", "created_at" FROM "test_page_token_struct" WHERE (Count > $1) AND (("count" < $2) OR ("count" = $2 AND "id" > $3)) ORDER BY "count" DESC, "id" ASC LIMIT 2`, query)
+	require.Equal(t, []interface{}{1, "5", "abc"}, args)
+
+	// invalid token
+	_, _, err = filterQuery(r, Query("Count > $1", 1).After("foo"), true)
+	require.Equal(t, ErrInvalidPageToken, err)
+}
@@ -0,0 +1,507 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// defaultPartitionSuffix is appended to the table name of default partitions
+const defaultPartitionSuffix = "default"
+
+// partition is a partition of a partitioned table
+type partition struct {
+	name  string
+	bound string // bound is the partition bound, i.e. `FOR VALUES FROM (..) TO (..)` or `DEFAULT`
+}
+
+var partitionTimeRangeRegexp = regexp.MustCompile(`^FOR VALUES FROM \('([^']+)'\) TO \('([^']+)'\)$`)
+
+// timeRange returns the bounds of a range partition by timestamp
+func (x partition) timeRange() (from, to time.Time, ok bool) {
+	m := partitionTimeRangeRegexp.FindStringSubmatch(x.bound)
+	if m == nil {
+		return from, to, false
+	}
+
+	from, err := time.Parse(partitionBoundFormat, m[1])
+	if err != nil {
+		return from, to, false
+	}
+
+	to, err = time.Parse(partitionBoundFormat, m[2])
+	if err != nil {
+		return from, to, false
+	}
+
+	return from, to, true
+}
+
+func hasDefaultPartition(partitions []partition) bool {
+	for _, x := range partitions {
+		if x.bound == defaultBound {
+			return true
+		}
+	}
+	return false
+}
+
+// PartitionOptions configures MaintainPartitionsWithOptions.
+type PartitionOptions struct {
+	// DetachConcurrently detaches expired partitions without blocking queries
+	// on the partitioned table. It is used on Postgres 14 and newer, and only
+	// for tables without default partition, see `partitionByRange(default=false)`.
+	DetachConcurrently bool
+
+	// Archive is called for every expired partition before it is detached
+	// and dropped, i.e. to copy its rows elsewhere. If Archive returns an error,
+	// the partition is left untouched and MaintainPartitionsWithOptions returns the error.
+	Archive func(ctx context.Context, table, partition string) error
+}
+
+// MaintainPartitions creates partitions for registered structs with a
+// `partitionByRange(interval=...)` field. For each table it creates a partition
+// for the current interval, `premake` partitions for upcoming intervals and,
+// unless `default=false`, a default partition for all other rows. Postgres creates
+// the indexes of the partitioned table on every new partition. Partitions whose
+// rows are all older than `retention` are detached and dropped.
+//
+// Run MaintainPartitions after Migrate and then regularly, i.e. once a day,
+// so that partitions exist before rows for them are inserted.
+// Tables that haven't been migrated yet are skipped.
+// Partitions for ranges that already have rows in the default partition are
+// skipped and reported in the returned error.
+func (p *Postgres) MaintainPartitions(ctx context.Context) error {
+	return p.MaintainPartitionsWithOptions(ctx, PartitionOptions{})
+}
+
+// MaintainPartitionsWithOptions is like MaintainPartitions, with options
+// for expired partitions.
+func (p *Postgres) MaintainPartitionsWithOptions(ctx context.Context, opts PartitionOptions) error {
+	// the advisory lock is held by a session, so the lock, all partition
+	// statements and the unlock run on the same dedicated connection
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	px := p.withConn(conn)
+
+	// acquire the migrate lock, so that partitions aren't created
+	// while Migrate creates or changes their parent tables
+	if err := px.waitForAdvisoryLock(ctx, MigrateKey); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// when done, release lock on same connection and return it to the pool
+	defer func() {
+		px.advisoryUnlock(MigrateKey)
+		conn.Close()
+	}()
+
+	now := time.Now()
+	for _, r := range registeredStructs() {
+		if err := px.ensurePartitions(ctx, r, now); err != nil {
+			return err
+		}
+
+		if err := px.expirePartitions(ctx, r, now, opts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensurePartitions creates the default partition and all partitions
+// from the interval containing now up to `premake` intervals ahead.
+// Partitions can't be created while the default partition has rows in their
+// range. They are skipped and reported in the returned error.
+func (p *Postgres) ensurePartitions(ctx context.Context, r *metaStruct, now time.Time) error {
+	f, err := r.fields.rangePartitionField()
+	if err != nil {
+		return fmt.Errorf("%v: %w", r.name, err)
+	}
+	if f == nil {
+		return nil
+	}
+
+	partitions, err := p.describePartitions(ctx, r.name)
+	if isErrTableDoesNotExist(err) {
+		return nil // table is created by Migrate
+	} else if err != nil {
+		return err
+	}
+
+	exists := make(map[string]bool)
+	for _, x := range partitions {
+		exists[x.name] = true
+	}
+
+	tag := f.partitionByRange
+	start := truncateInterval(now.UTC(), tag.interval)
+	defaultName := toSnake(r.name, defaultPartitionSuffix)
+	skipped := make([]string, 0)
+
+	for i := 0; i <= tag.premake; i++ {
+		from := addInterval(start, tag.interval, i)
+		to := addInterval(start, tag.interval, i+1)
+
+		name := partitionName(r.name, tag.interval, from)
+		if exists[name] {
+			continue
+		}
+
+		if err := p.createPartition(ctx, name, r.name, rangeBound(from, to)); err != nil {
+			// the default partition already has rows for this range
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "check_violation" && exists[defaultName] {
+				skipped = append(skipped, name)
+				continue
+			}
+			return err
+		}
+	}
+
+	if !tag.noDefault && !exists[defaultName] {
+		if err := p.createPartition(ctx, defaultName, r.name, defaultBound); err != nil {
+			return err
+		}
+	}
+
+	if len(skipped) > 0 {
+		return fmt.Errorf("%v: partitions %v not created, move their rows out of default partition %v first",
+			r.name, strings.Join(skipped, ", "), defaultName)
+	}
+
+	return nil
+}
+
+// expirePartitions detaches and drops all partitions whose
+// upper bound is older than the retention.
+func (p *Postgres) expirePartitions(ctx context.Context, r *metaStruct, now time.Time, opts PartitionOptions) error {
+	f, err := r.fields.rangePartitionField()
+	if err != nil {
+		return fmt.Errorf("%v: %w", r.name, err)
+	}
+	if f == nil || f.partitionByRange.retention.isZero() {
+		return nil
+	}
+
+	partitions, err := p.describePartitions(ctx, r.name)
+	if isErrTableDoesNotExist(err) {
+		return nil // table is created by Migrate
+	} else if err != nil {
+		return err
+	}
+
+	concurrently := false
+	if opts.DetachConcurrently && !hasDefaultPartition(partitions) {
+		concurrently, err = p.isMinVersion(14)
+		if err != nil {
+			return err
+		}
+	}
+
+	retention := f.partitionByRange.retention
+	before := retention.before(now.UTC())
+
+	for _, x := range partitions {
+		_, to, ok := x.timeRange()
+		if !ok || to.After(before) {
+			continue
+		}
+
+		if opts.Archive != nil {
+			if err := opts.Archive(ctx, r.name, x.name); err != nil {
+				return fmt.Errorf("archive partition %v: %w", x.name, err)
+			}
+		}
+
+		reason := fmt.Sprintf("partition %v is older than %v", x.name, retention)
+		if err := p.detachPartition(ctx, x.name, r.name, concurrently, reason); err != nil {
+			return err
+		}
+
+		if err := p.dropTable(ctx, x.name, reason); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureFixedPartitions creates the partitions of tables partitioned by list or hash.
+// Partitions of new tables are created without looking them up first.
+func (p *Postgres) ensureFixedPartitions(ctx context.Context, r *metaStruct, created bool) error {
+	expected := r.fields.fixedPartitions(r.name)
+	if len(expected) == 0 {
+		return nil
+	}
+
+	existing := make(map[string]string)
+	if !created {
+		partitions, err := p.describePartitions(ctx, r.name)
+		if err != nil {
+			return err
+		}
+		for _, x := range partitions {
+			existing[x.name] = x.bound
+		}
+	}
+
+	for _, x := range expected {
+		bound, ok := existing[x.name]
+		if !ok {
+			if err := p.createPartition(ctx, x.name, r.name, x.bound); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// hash partitions can't be added without changing the bounds of all partitions
+		if strings.HasPrefix(x.bound, "FOR VALUES WITH") && bound != x.bound {
+			return fmt.Errorf("%v: partition %v has bound %v, expected %v", r.name, x.name, bound, x.bound)
+		}
+	}
+
+	return nil
+}
+
+// fixedPartitions returns the partitions of tables partitioned by list or hash.
+// List partitions are named after their value, hash partitions after their remainder.
+func (f fields) fixedPartitions(tableName string) []partition {
+	out := make([]partition, 0)
+	for _, x := range f {
+		switch {
+		case x.partitionByList != nil:
+			for _, v := range x.partitionByList.values {
+				out = append(out, partition{name: toSnake(tableName, v), bound: listBound(v)})
+			}
+			out = append(out, partition{name: toSnake(tableName, defaultPartitionSuffix), bound: defaultBound})
+
+		case x.partitionByHash != nil:
+			for i := 0; i < x.partitionByHash.modulus; i++ {
+				out = append(out, partition{name: fmt.Sprintf("%v_p%v", tableName, i), bound: hashBound(x.partitionByHash.modulus, i)})
+			}
+		}
+	}
+	return out
+}
+
+// checkPartitions validates the partition struct tags of all fields
+func (f fields) checkPartitions() error {
+	fieldsByTag := make(map[string]int)
+	for _, x := range f {
+		if x.partitionByRange != nil {
+			fieldsByTag["partitionByRange"]++
+		}
+		if x.partitionByList != nil {
+			fieldsByTag["partitionByList"]++
+		}
+		if x.partitionByHash != nil {
+			fieldsByTag["partitionByHash"]++
+		}
+	}
+
+	if len(fieldsByTag) > 1 {
+		return fmt.Errorf("only one of partitionByRange, partitionByList and partitionByHash is allowed")
+	}
+
+	if fieldsByTag["partitionByList"] > 1 || fieldsByTag["partitionByHash"] > 1 {
+		return fmt.Errorf("partitionByList and partitionByHash are only supported for one field")
+	}
+
+	// list values must map to distinct partition names
+	names := make(map[string]bool)
+	for _, x := range f.fixedPartitions("") {
+		if names[x.name] {
+			return fmt.Errorf("partitionByList: values map to the same partition name %v", strings.TrimPrefix(x.name, "_"))
+		}
+		names[x.name] = true
+	}
+
+	_, err := f.rangePartitionField()
+	return err
+}
+
+// rangePartitionField returns the field that MaintainPartitions partitions by,
+// or nil if partitions are not maintained automatically.
+func (f fields) rangePartitionField() (*field, error) {
+	var out *field
+	partitioned := 0
+	for _, x := range f {
+		if x.partitionByRange == nil {
+			continue
+		}
+
+		partitioned++
+		if x.partitionByRange.interval != "" {
+			out = x
+		}
+	}
+
+	if out == nil {
+		return nil, nil
+	}
+
+	if partitioned > 1 {
+		return nil, fmt.Errorf("partitionByRange: interval is only supported for tables partitioned by one field")
+	}
+
+	switch out.value.Interface().(type) {
+	case time.Time, *time.Time:
+	default:
+		return nil, fmt.Errorf("partitionByRange: interval requires %v to be time.Time", out.name)
+	}
+
+	return out, nil
+}
+
+// truncateInterval returns the start of the interval containing t.
+// Weeks start on Monday.
+func truncateInterval(t time.Time, interval string) time.Time {
+	y, m, d := t.Date()
+
+	switch interval {
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+
+	case "week":
+		weekday := (int(t.Weekday()) + 6) % 7 // days since Monday
+		return time.Date(y, m, d-weekday, 0, 0, 0, 0, t.Location())
+
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, t.Location())
+
+	default:
+		panic(fmt.Sprintf("unknown interval %v", interval))
+	}
+}
+
+// addInterval adds n intervals to t, which must be the start of an interval
+func addInterval(t time.Time, interval string, n int) time.Time {
+	switch interval {
+	case "day":
+		return t.AddDate(0, 0, n)
+
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+
+	case "month":
+		return t.AddDate(0, n, 0)
+
+	case "year":
+		return t.AddDate(n, 0, 0)
+
+	default:
+		panic(fmt.Sprintf("unknown interval %v", interval))
+	}
+}
+
+// partitionNameFormats are the time formats of partition name suffixes
+var partitionNameFormats = map[string]string{
+	"day":   "20060102",
+	"week":  "20060102",
+	"month": "200601",
+	"year":  "2006",
+}
+
+// partitionName returns the name of the partition starting at from,
+// i.e. `events_p202101` for the partition of January 2021.
+func partitionName(tableName, interval string, from time.Time) string {
+	return fmt.Sprintf("%v_p%v", tableName, from.Format(partitionNameFormats[interval]))
+}
+
+// partitionBoundFormat formats partition bounds like timestamp columns
+const partitionBoundFormat = "2006-01-02 15:04:05"
+
+// rangeBound returns the bound of a range partition by timestamp
+func rangeBound(from, to time.Time) string {
+	return fmt.Sprintf("FOR VALUES FROM (%v) TO (%v)",
+		QuoteLiteral(from.Format(partitionBoundFormat)),
+		QuoteLiteral(to.Format(partitionBoundFormat)))
+}
+
+// listBound returns the bound of a list partition
+func listBound(value string) string {
+	return fmt.Sprintf("FOR VALUES IN (%v)", QuoteLiteral(value))
+}
+
+// hashBound returns the bound of a hash partition, formatted like Postgres does
+func hashBound(modulus, remainder int) string {
+	return fmt.Sprintf("FOR VALUES WITH (modulus %v, remainder %v)", modulus, remainder)
+}
+
+// defaultBound is the bound of default partitions
+const defaultBound = "DEFAULT"
+
+func (p *Postgres) createPartition(ctx context.Context, name, tableName, bound string) error {
+	q := queryf()
+	q.Append("CREATE")
+
+	if p.createTempTables {
+		q.Append("TEMPORARY")
+	}
+
+	q.Appendf("TABLE IF NOT EXISTS %v PARTITION OF %v", mustIdentifier(name), mustIdentifier(tableName))
+	q.Append(bound)
+
+	return p.execDDL(ctx, q.String(), fmt.Sprintf("partition %v does not exist", name))
+}
+
+func (p *Postgres) detachPartition(ctx context.Context, name, tableName string, concurrently bool, reason string) error {
+	q := queryf()
+	q.Appendf("ALTER TABLE %v DETACH PARTITION %v", mustIdentifier(tableName), mustIdentifier(name))
+
+	if concurrently {
+		q.Append("CONCURRENTLY")
+	}
+
+	return p.execDDL(ctx, q.String(), reason)
+}
+
+func (p *Postgres) dropTable(ctx context.Context, tableName, reason string) error {
+	query := fmt.Sprintf("DROP TABLE IF EXISTS %v", mustIdentifier(tableName))
+	return p.execDDL(ctx, query, reason)
+}
+
+// describePartitions returns all partitions of a partitioned table
+func (p *Postgres) describePartitions(ctx context.Context, tableName string) ([]partition, error) {
+	queryf := `
+SELECT
+  c.relname :: text AS name,
+  pg_get_expr(c.relpartbound, c.oid) AS bound
+FROM pg_inherits AS i
+JOIN pg_class AS c ON c.oid = i.inhrelid
+WHERE i.inhparent = %v :: REGCLASS
+ORDER BY c.relname`
+
+	query := fmt.Sprintf(queryf, QuoteLiteral(tableName))
+	rows, err := p.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]partition, 0)
+	for rows.Next() {
+		x := partition{}
+		if err := rows.Scan(&x.name, &x.bound); err != nil {
+			return nil, err
+		}
+		out = append(out, x)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
@@ -0,0 +1,336 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncateInterval(t *testing.T) {
+	now := time.Date(2021, 3, 18, 15, 4, 5, 6, time.UTC) // Thursday
+
+	tt := []struct {
+		interval string
+		start    time.Time
+		next     time.Time
+		name     string
+	}{
+		{"day", time.Date(2021, 3, 18, 0, 0, 0, 0, time.UTC), time.Date(2021, 3, 19, 0, 0, 0, 0, time.UTC), "foo_p20210318"},
+		{"week", time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC), time.Date(2021, 3, 22, 0, 0, 0, 0, time.UTC), "foo_p20210315"},
+		{"month", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC), "foo_p202103"},
+		{"year", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), "foo_p2021"},
+	}
+
+	for _, x := range tt {
+		start := truncateInterval(now, x.interval)
+		require.Equal(t, x.start, start, x.interval)
+		require.Equal(t, x.next, addInterval(start, x.interval, 1), x.interval)
+		require.Equal(t, x.name, partitionName("foo", x.interval, start), x.interval)
+	}
+
+	// sunday belongs to the week starting on monday before
+	require.Equal(t, time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC),
+		truncateInterval(time.Date(2021, 3, 21, 23, 0, 0, 0, time.UTC), "week"))
+
+	// months don't overflow at the end of a month
+	require.Equal(t, time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC),
+		addInterval(truncateInterval(time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC), "month"), "month", 1))
+}
+
+func TestPartitionRetention(t *testing.T) {
+	now := time.Date(2021, 3, 18, 15, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		in     string
+		before time.Time
+	}{
+		{"90d", time.Date(2020, 12, 18, 15, 0, 0, 0, time.UTC)},
+		{"2w", time.Date(2021, 3, 4, 15, 0, 0, 0, time.UTC)},
+		{"6mo", time.Date(2020, 9, 18, 15, 0, 0, 0, time.UTC)},
+		{"1y", time.Date(2020, 3, 18, 15, 0, 0, 0, time.UTC)},
+	}
+
+	for _, x := range tt {
+		r, err := parsePartitionRetention(x.in)
+		require.NoError(t, err, x.in)
+		require.Equal(t, x.in, r.String())
+		require.Equal(t, x.before, r.before(now), x.in)
+	}
+
+	_, err := parsePartitionRetention("1h")
+	require.Error(t, err)
+}
+
+func TestPartitionTimeRange(t *testing.T) {
+	from, to, ok := partition{bound: "FOR VALUES FROM ('2021-12-01 00:00:00') TO ('2022-01-01 00:00:00')"}.timeRange()
+	require.True(t, ok)
+	require.Equal(t, time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC), from)
+	require.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), to)
+
+	_, _, ok = partition{bound: "DEFAULT"}.timeRange()
+	require.False(t, ok)
+
+	_, _, ok = partition{bound: "FOR VALUES FROM (MINVALUE) TO ('2022-01-01 00:00:00')"}.timeRange()
+	require.False(t, ok)
+
+	require.True(t, hasDefaultPartition([]partition{{bound: "DEFAULT"}}))
+	require.False(t, hasDefaultPartition([]partition{{bound: "FOR VALUES FROM (1) TO (2)"}}))
+}
+
+type TestRangePartitionField_Struct struct {
+	Id        string    `db:"pk(composite=[CreatedAt])"`
+	CreatedAt time.Time `db:"partitionByRange(interval=month)"`
+}
+
+type TestRangePartitionField_StructNoTime struct {
+	Id  string `db:"pk(composite=[Num])"`
+	Num int    `db:"partitionByRange(interval=month)"`
+}
+
+type TestRangePartitionField_StructMultiple struct {
+	Id        string    `db:"pk(composite=[CreatedAt, Num])"`
+	CreatedAt time.Time `db:"partitionByRange(interval=month)"`
+	Num       int       `db:"partitionByRange"`
+}
+
+func TestRangePartitionField(t *testing.T) {
+	r := mustNewMetaStruct(&TestRangePartitionField_Struct{})
+	f, err := r.fields.rangePartitionField()
+	require.NoError(t, err)
+	require.Equal(t, "CreatedAt", f.name)
+
+	// no interval
+	r = mustNewMetaStruct(&TestEnsureTable_PartitionByRange_Struct{})
+	f, err = r.fields.rangePartitionField()
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	_, err = newMetaStruct(&TestRangePartitionField_StructNoTime{})
+	require.Error(t, err)
+
+	_, err = newMetaStruct(&TestRangePartitionField_StructMultiple{})
+	require.Error(t, err)
+}
+
+type TestFixedPartitions_StructList struct {
+	Tenant string `db:"pk(composite=[Id]),partitionByList(values=[acme, \"ACME Corp\"])"`
+	Id     string
+}
+
+type TestFixedPartitions_StructHash struct {
+	Id string `db:"pk,partitionByHash(modulus=3)"`
+}
+
+type TestFixedPartitions_StructMixed struct {
+	Id     string `db:"pk(composite=[Tenant]),partitionByHash(modulus=3)"`
+	Tenant string `db:"partitionByList(values=[acme])"`
+}
+
+type TestFixedPartitions_StructDuplicate struct {
+	Tenant string `db:"pk,partitionByList(values=[acme_corp, AcmeCorp])"`
+}
+
+func TestFixedPartitions(t *testing.T) {
+	r := mustNewMetaStruct(&TestFixedPartitions_StructList{})
+	require.Equal(t, []partition{
+		{"foo_acme", "FOR VALUES IN ('acme')"},
+		{"foo_acme_corp", "FOR VALUES IN ('ACME Corp')"},
+		{"foo_default", "DEFAULT"},
+	}, r.fields.fixedPartitions("foo"))
+
+	r = mustNewMetaStruct(&TestFixedPartitions_StructHash{})
+	require.Equal(t, []partition{
+		{"foo_p0", "FOR VALUES WITH (modulus 3, remainder 0)"},
+		{"foo_p1", "FOR VALUES WITH (modulus 3, remainder 1)"},
+		{"foo_p2", "FOR VALUES WITH (modulus 3, remainder 2)"},
+	}, r.fields.fixedPartitions("foo"))
+
+	// range partitions are created by MaintainPartitions
+	r = mustNewMetaStruct(&TestEnsurePartitions_Struct{})
+	require.Len(t, r.fields.fixedPartitions("foo"), 0)
+
+	_, err := newMetaStruct(&TestFixedPartitions_StructMixed{})
+	require.Error(t, err)
+
+	_, err = newMetaStruct(&TestFixedPartitions_StructDuplicate{})
+	require.Error(t, err)
+}
+
+func TestDumpSchema_FixedPartitions(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, dumpSchema(buf, []*metaStruct{
+		mustNewMetaStruct(&TestFixedPartitions_StructHash{}),
+	}))
+
+	require.Equal(t, `CREATE TABLE IF NOT EXISTS "test_fixed_partitions_struct_hash" ( "id" text not null default '' , CONSTRAINT "test_fixed_partitions_struct_hash_pk" PRIMARY KEY ("id") ) PARTITION BY HASH ("id");
+
+CREATE TABLE IF NOT EXISTS "test_fixed_partitions_struct_hash_p0" PARTITION OF "test_fixed_partitions_struct_hash" FOR VALUES WITH (modulus 3, remainder 0);
+
+CREATE TABLE IF NOT EXISTS "test_fixed_partitions_struct_hash_p1" PARTITION OF "test_fixed_partitions_struct_hash" FOR VALUES WITH (modulus 3, remainder 1);
+
+CREATE TABLE IF NOT EXISTS "test_fixed_partitions_struct_hash_p2" PARTITION OF "test_fixed_partitions_struct_hash" FOR VALUES WITH (modulus 3, remainder 2);
+
+`, buf.String())
+}
+
+func TestEnsureTable_PartitionByList(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	r := mustNewMetaStruct(&TestFixedPartitions_StructList{})
+	require.NoError(t, db.ensureTable(context.Background(), r))
+
+	// partitions already exist
+	require.NoError(t, db.ensureTable(context.Background(), r))
+
+	partitions, err := db.describePartitions(context.Background(), "test_fixed_partitions_struct_list")
+	require.NoError(t, err)
+	require.Equal(t, []partition{
+		{"test_fixed_partitions_struct_list_acme", "FOR VALUES IN ('acme')"},
+		{"test_fixed_partitions_struct_list_acme_corp", "FOR VALUES IN ('ACME Corp')"},
+		{"test_fixed_partitions_struct_list_default", "DEFAULT"},
+	}, partitions)
+
+	_, err = db.Exec(context.Background(), `INSERT INTO test_fixed_partitions_struct_list (tenant, id) VALUES ('acme', 'a'), ('other', 'b')`)
+	require.NoError(t, err)
+}
+
+func TestEnsureTable_PartitionByHash(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	r := mustNewMetaStruct(&TestFixedPartitions_StructHash{})
+	require.NoError(t, db.ensureTable(context.Background(), r))
+
+	// partitions already exist
+	require.NoError(t, db.ensureTable(context.Background(), r))
+
+	partitions, err := db.describePartitions(context.Background(), "test_fixed_partitions_struct_hash")
+	require.NoError(t, err)
+	require.Len(t, partitions, 3)
+
+	// changing the modulus requires a manual migration
+	r.fields[0].partitionByHash.modulus = 4
+	require.Error(t, db.ensureTable(context.Background(), r))
+}
+
+type TestEnsurePartitions_Struct struct {
+	Id        string    `db:"pk(composite=[CreatedAt])"`
+	CreatedAt time.Time `db:"partitionByRange(interval=month, premake=2)"`
+	Name      string    `db:"index"`
+}
+
+func TestEnsurePartitions(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	r := mustNewMetaStruct(&TestEnsurePartitions_Struct{})
+	require.NoError(t, db.ensureTable(context.Background(), r))
+
+	now := time.Date(2021, 12, 18, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, db.ensurePartitions(context.Background(), r, now))
+
+	// partitions already exist
+	require.NoError(t, db.ensurePartitions(context.Background(), r, now))
+
+	partitions, err := db.describePartitions(context.Background(), "test_ensure_partitions_struct")
+	require.NoError(t, err)
+	require.Equal(t, []partition{
+		{"test_ensure_partitions_struct_default", "DEFAULT"},
+		{"test_ensure_partitions_struct_p202112", "FOR VALUES FROM ('2021-12-01 00:00:00') TO ('2022-01-01 00:00:00')"},
+		{"test_ensure_partitions_struct_p202201", "FOR VALUES FROM ('2022-01-01 00:00:00') TO ('2022-02-01 00:00:00')"},
+		{"test_ensure_partitions_struct_p202202", "FOR VALUES FROM ('2022-02-01 00:00:00') TO ('2022-03-01 00:00:00')"},
+	}, partitions)
+
+	// partitions inherit indexes of the partitioned table
+	tbl, err := db.describeTable(context.Background(), "test_ensure_partitions_struct_p202201")
+	require.NoError(t, err)
+	require.Len(t, tbl.Indexes, 2)
+
+	// rows are routed to partitions
+	_, err = db.Exec(context.Background(), `INSERT INTO test_ensure_partitions_struct (id, created_at, name) VALUES ('a', '2022-01-05', 'foo'), ('b', '2030-01-01', 'bar')`)
+	require.NoError(t, err)
+
+	// the default partition has a row for 2030-01, that partition is skipped
+	err = db.ensurePartitions(context.Background(), r, time.Date(2029, 12, 18, 0, 0, 0, 0, time.UTC))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "test_ensure_partitions_struct_p203001")
+
+	partitions, err = db.describePartitions(context.Background(), "test_ensure_partitions_struct")
+	require.NoError(t, err)
+	require.Contains(t, partitions, partition{"test_ensure_partitions_struct_p202912", "FOR VALUES FROM ('2029-12-01 00:00:00') TO ('2030-01-01 00:00:00')"})
+	require.Contains(t, partitions, partition{"test_ensure_partitions_struct_p203002", "FOR VALUES FROM ('2030-02-01 00:00:00') TO ('2030-03-01 00:00:00')"})
+	require.NotContains(t, partitions, partition{"test_ensure_partitions_struct_p203001", "FOR VALUES FROM ('2030-01-01 00:00:00') TO ('2030-02-01 00:00:00')"})
+}
+
+type TestEnsurePartitions_MissingTableStruct struct {
+	Id        string    `db:"pk(composite=[CreatedAt])"`
+	CreatedAt time.Time `db:"partitionByRange(interval=month, retention=1mo)"`
+}
+
+func TestEnsurePartitions_MissingTable(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// tables that haven't been migrated yet are skipped
+	r := mustNewMetaStruct(&TestEnsurePartitions_MissingTableStruct{})
+	require.NoError(t, db.ensurePartitions(context.Background(), r, time.Now()))
+	require.NoError(t, db.expirePartitions(context.Background(), r, time.Now(), PartitionOptions{}))
+}
+
+type TestExpirePartitions_Struct struct {
+	Id        string    `db:"pk(composite=[CreatedAt])"`
+	CreatedAt time.Time `db:"partitionByRange(interval=month, premake=0, retention=1mo)"`
+}
+
+func TestExpirePartitions(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	r := mustNewMetaStruct(&TestExpirePartitions_Struct{})
+	require.NoError(t, db.ensureTable(context.Background(), r))
+
+	// create partitions for October, November and December
+	for month := time.October; month <= time.December; month++ {
+		require.NoError(t, db.ensurePartitions(context.Background(), r, time.Date(2021, month, 1, 0, 0, 0, 0, time.UTC)))
+	}
+
+	now := time.Date(2021, 12, 18, 0, 0, 0, 0, time.UTC)
+
+	// archive errors leave partitions untouched
+	archiveErr := fmt.Errorf("archive failed")
+	err = db.expirePartitions(context.Background(), r, now, PartitionOptions{
+		Archive: func(ctx context.Context, table, partition string) error {
+			return archiveErr
+		},
+	})
+	require.True(t, errors.Is(err, archiveErr))
+
+	// October ended more than a month ago
+	archived := make([]string, 0)
+	require.NoError(t, db.expirePartitions(context.Background(), r, now, PartitionOptions{
+		Archive: func(ctx context.Context, table, partition string) error {
+			archived = append(archived, table+"."+partition)
+			return nil
+		},
+	}))
+	require.Equal(t, []string{"test_expire_partitions_struct.test_expire_partitions_struct_p202110"}, archived)
+
+	partitions, err := db.describePartitions(context.Background(), "test_expire_partitions_struct")
+	require.NoError(t, err)
+
+	names := make([]string, 0)
+	for _, x := range partitions {
+		names = append(names, x.name)
+	}
+	require.Equal(t, []string{
+		"test_expire_partitions_struct_default",
+		"test_expire_partitions_struct_p202111",
+		"test_expire_partitions_struct_p202112",
+	}, names)
+}
@@ -2,6 +2,10 @@ package postgres
 
 import "strconv"
 
+// maxPlaceholders is the max number of placeholders ($n) Postgres
+// accepts in a single query.
+const maxPlaceholders = 65535
+
 // placeholderMap is used to map placeholders ($n) to field values.
 //
 // The index of the slice is used as placeholder position,
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/jpillora/backoff"
+	"github.com/lib/pq"
 )
 
 var (
@@ -22,7 +23,7 @@ var (
 	MigrateKey = 8267205493056421913
 
 	// maxAdvisoryLockAttemtps is the max amount of times it tries
-	// to acquire a lock before it panics
+	// to acquire a lock before it returns ErrMigrateLockTimeout
 	maxAdvisoryLockAttemtps = 50
 )
 
@@ -38,6 +39,19 @@ type Postgres struct {
 	// createTempTables can be set to true to just create temporary tables,
 	// useful for tests
 	createTempTables bool
+
+	// plan is set by MigratePlan to record DDL statements instead of executing them
+	plan *migrationPlan
+
+	// conn is set by withConn to run all queries on one dedicated connection
+	conn *sql.Conn
+}
+
+// sqlConn is implemented by *sql.DB and *sql.Conn
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 // Open creates a new Postgres client.
@@ -100,6 +114,22 @@ func (p *Postgres) clone() (*Postgres, error) {
 	return px, nil
 }
 
+// withConn returns a copy of *Postgres that runs all queries on conn.
+// Session state like advisory locks is kept until conn is closed.
+func (p *Postgres) withConn(conn *sql.Conn) *Postgres {
+	px := *p
+	px.conn = conn
+	return &px
+}
+
+// sqlConn returns the dedicated connection if set, or the connection pool
+func (p *Postgres) sqlConn() sqlConn {
+	if p.conn != nil {
+		return p.conn
+	}
+	return p.db
+}
+
 // Close closes the database and prevents new queries from starting.
 // Close then waits for all queries that have started processing on the server
 // to finish.
@@ -161,36 +191,103 @@ func (p *Postgres) Ping(ctx context.Context) error {
 }
 
 // Get finds a record by its primary keys.
+// It returns a *NotFoundError, which matches ErrNotFound and sql.ErrNoRows
+// with errors.Is, if no record exists.
 func (p *Postgres) Get(ctx context.Context, s Struct) error {
 	return getStruct(p, ctx, s)
 }
 
+// GetMany finds records for all structs in a slice by their primary keys.
+// If records are missing for some structs, the remaining structs are loaded
+// anyway and a *MissingRecordsError is returned.
+func (p *Postgres) GetMany(ctx context.Context, s StructSlice) error {
+	return getManyStruct(p, ctx, s)
+}
+
 // Filter finds records based on QueryStmt. See QueryStmt for more details.
 func (p *Postgres) Filter(ctx context.Context, s StructSlice, q *QueryStmt) error {
 	return filterStruct(p, ctx, s, q)
 }
 
+// FilterIter finds records based on QueryStmt, just like Filter, but returns
+// an Iterator that decodes one record at a time into a struct of the same
+// type as s. Unlike Filter, all records are returned, unless QueryStmt.Limit
+// is set. The Iterator must be closed when done.
+func (p *Postgres) FilterIter(ctx context.Context, s Struct, q *QueryStmt) (*Iterator, error) {
+	return filterIterStruct(p, ctx, s, q)
+}
+
+// Count returns the number of records matching QueryStmt.
+// Order, limit and page token of QueryStmt are ignored.
+func (p *Postgres) Count(ctx context.Context, s Struct, q *QueryStmt) (int64, error) {
+	return countStruct(p, ctx, s, q)
+}
+
+// Exists returns true if at least one record matches QueryStmt.
+func (p *Postgres) Exists(ctx context.Context, s Struct, q *QueryStmt) (bool, error) {
+	return existsStruct(p, ctx, s, q)
+}
+
 // Insert creates a new record.
+// It returns a *UniqueViolationError or *ForeignKeyViolationError
+// if the new record violates a constraint.
 func (p *Postgres) Insert(ctx context.Context, s Struct, fieldMask ...StructFieldName) error {
 	return insertStruct(p, ctx, s, fieldMask...)
 }
 
+// InsertMany creates new records for all structs in a slice at once.
+// It uses Postgres' COPY protocol and is meant for large batches.
+// Unlike Insert, values set by the database (i.e. column defaults)
+// are not read back into the slice.
+func (p *Postgres) InsertMany(ctx context.Context, s StructSlice, fieldMask ...StructFieldName) error {
+	return p.TransactionContext(ctx, func(tx *Transaction) error {
+		return insertManyStruct(tx, ctx, s, fieldMask...)
+	})
+}
+
 // Update updates an existing record by looking at the orimary keys of a struct.
+// It returns a *NotFoundError, which matches ErrNotFound and sql.ErrNoRows
+// with errors.Is, if no record exists.
 func (p *Postgres) Update(ctx context.Context, s Struct, fieldMask ...StructFieldName) error {
 	return updateStruct(p, ctx, s, fieldMask...)
 }
 
+// UpdateWhere updates all records matching QueryStmt with the values of a struct
+// and returns the number of updated records. Primary keys are not updated.
+// Use QueryAll to update all records.
+func (p *Postgres) UpdateWhere(ctx context.Context, s Struct, q *QueryStmt, fieldMask ...StructFieldName) (int64, error) {
+	return updateWhereStruct(p, ctx, s, q, fieldMask...)
+}
+
 // Save creates a new record or updates an existing record by looking at
 // the primary keys of a struct.
 func (p *Postgres) Save(ctx context.Context, s Struct, fieldMask ...StructFieldName) error {
 	return saveStruct(p, ctx, s, fieldMask...)
 }
 
+// SaveMany creates new records or updates existing records for all structs
+// in a slice, by looking at the primary keys of each struct. Records are saved
+// in batches within one transaction. A slice must not contain the same
+// primary key twice.
+func (p *Postgres) SaveMany(ctx context.Context, s StructSlice, fieldMask ...StructFieldName) error {
+	return p.TransactionContext(ctx, func(tx *Transaction) error {
+		return saveManyStruct(tx, ctx, s, fieldMask...)
+	})
+}
+
 // Delete deletes a record by looking at the primary keys of a struct.
+// It returns a *NotFoundError, which matches ErrNotFound and sql.ErrNoRows
+// with errors.Is, if no record exists.
 func (p *Postgres) Delete(ctx context.Context, s Struct) error {
 	return deleteStruct(p, ctx, s)
 }
 
+// DeleteWhere deletes all records matching QueryStmt and returns
+// the number of deleted records. Use QueryAll to delete all records.
+func (p *Postgres) DeleteWhere(ctx context.Context, s Struct, q *QueryStmt) (int64, error) {
+	return deleteWhereStruct(p, ctx, s, q)
+}
+
 // Migrate runs SQL migrations for structs registered with `Register`.
 // Migrations are non-destructive and only backwards-compatible changes
 // will be performed, in particular:
@@ -199,13 +296,47 @@ func (p *Postgres) Delete(ctx context.Context, s Struct) error {
 //  * New indexes are created
 //  * New unique indexes are created (if possible)
 //  * New foreign keys are created (if possible)
+//  * New check constraints are created and validated (if possible)
+//  * Versioned migrations registered with `RegisterMigration` are applied
 //
 // Migrate blocks until it successfully acquired a global lock using Postgres' advisory locks.
 // This guarantees that only one Migrate function can run at a time across different processes.
+// If the lock can't be acquired after several attempts, ErrMigrateLockTimeout is returned.
+// Cancelling ctx stops waiting for the lock and aborts running migrations.
 //
 // The performed migrations as mentioned above are idempotent.
+// Use MigratePlan to review migrations before running them.
+// Use MigrateWithOptions to drop columns, indexes and foreign keys.
 func (p *Postgres) Migrate(ctx context.Context) error {
-	// TODO implement context.Context
+	return p.MigrateWithOptions(ctx, MigrateOptions{})
+}
+
+// MigrateWithOptions runs migrations just like Migrate. If opts.AllowDestructive
+// is set, columns, indexes and foreign keys listed in opts.Drop are dropped
+// afterwards, if they are no longer described by their struct.
+func (p *Postgres) MigrateWithOptions(ctx context.Context, opts MigrateOptions) error {
+	return p.migrate(ctx, registeredStructs(), registeredMigrations(), opts)
+}
+
+// MigrateStructs runs migrations just like Migrate, but only for the given
+// registered structs and the structs they reference with foreign keys.
+// Referenced structs are migrated first. Versioned migrations registered
+// with `RegisterMigration` are not applied, because they may touch tables
+// of other structs. Use Migrate to apply them.
+func (p *Postgres) MigrateStructs(ctx context.Context, s ...Struct) error {
+	rs, err := resolveStructs(s...)
+	if err != nil {
+		return err
+	}
+
+	return p.migrate(ctx, rs, nil, MigrateOptions{})
+}
+
+func (p *Postgres) migrate(ctx context.Context, rs []*metaStruct, ms []*migration, opts MigrateOptions) error {
+	drops, err := opts.drops()
+	if err != nil {
+		return err
+	}
 
 	// create new postgres instance and only allow it to have 1 connection
 	px, err := p.clone()
@@ -218,7 +349,10 @@ func (p *Postgres) Migrate(ctx context.Context) error {
 	px.SetMaxIdleConns(0)
 
 	// acquire new lock on connection
-	px.waitForAdvisoryLock(MigrateKey)
+	if err := px.waitForAdvisoryLock(ctx, MigrateKey); err != nil {
+		px.Close()
+		return err
+	}
 
 	// when done, release lock on same connection and close the cloned postgres instance
 	defer func() {
@@ -227,15 +361,38 @@ func (p *Postgres) Migrate(ctx context.Context) error {
 	}()
 
 	// run the following commands on same postgres connection via `px` ...
+	return px.runMigrations(ctx, rs, ms, drops)
+}
+
+// runMigrations runs all migration steps in order. It is shared by migrate
+// and MigratePlanWithOptions, so that a plan covers the same steps.
+func (p *Postgres) runMigrations(ctx context.Context, rs []*metaStruct, ms []*migration, drops []registeredDrop) error {
+	for _, r := range rs {
+		if err := p.ensureTable(ctx, r); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range rs {
+		if err := p.ensureForeignKeys(ctx, r); err != nil {
+			return err
+		}
+	}
+
+	if err := p.ensureMigrations(ctx, ms); err != nil {
+		return err
+	}
 
-	for _, r := range structs {
-		if err := px.ensureTable(r); err != nil {
+	for _, d := range drops {
+		if err := p.ensureDropped(ctx, d.r, d.Drop); err != nil {
 			return err
 		}
 	}
 
-	for _, r := range structs {
-		if err := px.ensureForeignKeys(r); err != nil {
+	// checks are validated last, so that existing rows violating them don't block
+	// other migrations, and versioned migrations can fix those rows first
+	for _, r := range rs {
+		if err := p.validateChecks(ctx, r); err != nil {
 			return err
 		}
 	}
@@ -246,18 +403,20 @@ func (p *Postgres) Migrate(ctx context.Context) error {
 // EnsureTable creates table if it doesn't exist and makes sure
 // primary keys, unique indexes and indexes are set correctly.
 // It is non-destructive, and will not delete existing columns for example.
-func (p *Postgres) ensureTable(r *metaStruct) error {
+func (p *Postgres) ensureTable(ctx context.Context, r *metaStruct) error {
 	// get details about table
-	tbl, err := p.describeTable(toSnake(r.name))
+	tbl, err := p.describeTable(ctx, toSnake(r.name))
+	created := false
 	if isErrTableDoesNotExist(err) {
 
 		// create table first
-		if err := p.createTable(r); err != nil {
+		if err := p.createTable(ctx, r); err != nil {
 			return err
 		}
+		created = true
 
 		// load fresh details
-		tbl, err = p.describeTable(toSnake(r.name))
+		tbl, err = p.describeTable(ctx, toSnake(r.name))
 		if err != nil {
 			return err
 		}
@@ -270,12 +429,75 @@ func (p *Postgres) ensureTable(r *metaStruct) error {
 	// (only add new columns, existing columns are not deleted)
 	for _, f := range r.fields {
 		if !tbl.hasColumnByName(f.name) {
-			if err := p.addColumn(toSnake(r.name), toSnake(f.name), f.columnType()); err != nil {
+
+			// rename old column, if field was renamed
+			if f.renamedFrom != nil && tbl.hasColumnByName(f.renamedFrom.name) {
+				if err := p.renameColumn(ctx, toSnake(r.name), toSnake(f.renamedFrom.name), toSnake(f.name)); err != nil {
+					return err
+				}
+
+				// rename indexes whose names are derived from the field name
+				renamed := r.fields.renamedIndexNames(f.renamedFrom.name, f.name)
+				for _, oldName := range sortedStringKeys(renamed) {
+					oldIndexName, newIndexName := toSnake(r.name, oldName), toSnake(r.name, renamed[oldName])
+					if !tbl.hasIndexByName(oldIndexName) || tbl.hasIndexByName(newIndexName) {
+						continue
+					}
+
+					if err := p.renameIndex(ctx, oldIndexName, newIndexName); err != nil {
+						return err
+					}
+					tbl.renameIndex(oldIndexName, newIndexName)
+				}
+				continue
+			}
+
+			if err := p.addColumn(ctx, toSnake(r.name), toSnake(f.name), f.columnType()); err != nil {
 				return err
 			}
 		}
 	}
 
+	// widen types of existing columns, if the conversion is known to be safe
+	// (all other type changes are reported by Drift)
+	for _, f := range r.fields {
+		c, ok := tbl.column(f.name)
+		if !ok {
+			continue
+		}
+
+		expectedType, expectedNullable := parseColumnType(f.columnType())
+		if equalDataType(expectedType, c.DataType) {
+			continue
+		}
+
+		using, ok := safeTypeChange(c.DataType, expectedType)
+		if !ok {
+			continue
+		}
+
+		// primary keys are always not null
+		if stringSliceContains(r.fields.primaryNames(), f.name) {
+			expectedNullable = false
+		}
+
+		// skip changes that would fail for existing rows, Drift still reports the column
+		if checkedTypeChanges[[2]string{strings.ToLower(c.DataType), strings.ToLower(expectedType)}] {
+			ok, err := p.canChangeColumnType(ctx, toSnake(r.name), c.Name, using)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		dataType, dflt := splitColumnType(f.columnType())
+		if err := p.alterColumnType(ctx, toSnake(r.name), c.Name, dataType, fmt.Sprintf(using, mustIdentifier(c.Name)), dflt, expectedNullable && !bool(c.IsNullable)); err != nil {
+			return err
+		}
+	}
+
 	// ensure primary key
 	primaryNames := r.fields.primaryNames()
 	if len(primaryNames) > 0 {
@@ -286,10 +508,10 @@ func (p *Postgres) ensureTable(r *metaStruct) error {
 			IsUnique:  true,
 			IsPrimary: true,
 		}) {
-			if err := p.createIndex(toSnake(r.name, "pk"), r.name, primaryNames, true, !r.fields.hasPartitionedField()); err != nil {
+			if err := p.createIndex(ctx, toSnake(r.name, "pk"), r.name, primaryNames, true, !r.fields.hasPartitionedField(), indexStructTag{}); err != nil {
 				return err
 			}
-			if err := p.addPrimaryKey(toSnake(r.name), toSnake(r.name, "pk"), toSnake(r.name, "pk")); err != nil {
+			if err := p.addPrimaryKey(ctx, toSnake(r.name), toSnake(r.name, "pk"), toSnake(r.name, "pk")); err != nil {
 				return err
 			}
 		}
@@ -299,15 +521,12 @@ func (p *Postgres) ensureTable(r *metaStruct) error {
 	uniqueIndexes := r.fields.uniqueIndexes()
 	if len(uniqueIndexes) > 0 {
 
-		// add missing unique indexes
-		for indexName, fieldNames := range uniqueIndexes {
-			if !tbl.hasIndex(index{
-				Name:     toSnake(r.name, indexName),
-				Type:     "btree",
-				Columns:  fieldNames,
-				IsUnique: true,
-			}) {
-				if err := p.createIndex(toSnake(r.name, indexName), toSnake(r.name), fieldNames, true, !r.fields.hasPartitionedField()); err != nil {
+		// add missing unique indexes, changed definitions are reported by Drift
+		for _, indexName := range sortedKeys(uniqueIndexes) {
+			fieldNames := uniqueIndexes[indexName]
+			tag := r.fields.indexTag(indexName, true)
+			if !tbl.hasIndexByName(toSnake(r.name, indexName)) {
+				if err := p.createIndex(ctx, toSnake(r.name, indexName), toSnake(r.name), fieldNames, true, !r.fields.hasPartitionedField(), tag); err != nil {
 					return err
 				}
 			}
@@ -318,51 +537,141 @@ func (p *Postgres) ensureTable(r *metaStruct) error {
 	indexes := r.fields.indexes()
 	if len(indexes) > 0 {
 
-		// add missing indexes
-		for indexName, fieldNames := range indexes {
-			if !tbl.hasIndex(index{
-				Name:    toSnake(r.name, indexName),
-				Type:    "btree",
-				Columns: fieldNames,
-			}) {
-				if err := p.createIndex(toSnake(r.name, indexName), toSnake(r.name), fieldNames, false, !r.fields.hasPartitionedField()); err != nil {
+		// add missing indexes, changed definitions are reported by Drift
+		for _, indexName := range sortedKeys(indexes) {
+			fieldNames := indexes[indexName]
+			tag := r.fields.indexTag(indexName, false)
+			if !tbl.hasIndexByName(toSnake(r.name, indexName)) {
+				if err := p.createIndex(ctx, toSnake(r.name, indexName), toSnake(r.name), fieldNames, false, !r.fields.hasPartitionedField(), tag); err != nil {
 					return err
 				}
 			}
 		}
 	}
 
+	// ensure check constraints, new tables were created with them
+	if !created {
+		if err := p.ensureChecks(ctx, r); err != nil {
+			return err
+		}
+	}
+
+	// ensure list and hash partitions, after indexes so that partitions inherit them
+	if err := p.ensureFixedPartitions(ctx, r, created); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ensureChecks adds missing check constraints without locking the table
+// while existing rows are validated, see validateChecks.
+func (p *Postgres) ensureChecks(ctx context.Context, r *metaStruct) error {
+	checks, err := r.fields.checks()
+	if err != nil {
+		return err
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+
+	existing, err := p.describeChecks(ctx, toSnake(r.name))
+	if err != nil {
+		return err
+	}
+
+	// changed expressions are not migrated, but reported by Drift
+	for _, c := range checks {
+		constraintName := toSnake(r.name, c.name)
+		if _, exists := existing[constraintName]; exists {
+			continue
+		}
+
+		// partitioned tables don't support NOT VALID, so their rows are validated right away
+		notValid := !r.fields.hasPartitionedField()
+		if err := p.addCheck(ctx, toSnake(r.name), constraintName, c.expr, notValid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateChecks validates existing rows against check constraints that were
+// added as NOT VALID. Checks that existing rows violate stay unvalidated, are
+// reported by Drift and validated again on the next run.
+func (p *Postgres) validateChecks(ctx context.Context, r *metaStruct) error {
+	checks, err := r.fields.checks()
+	if err != nil {
+		return err
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+
+	existing, err := p.describeChecks(ctx, toSnake(r.name))
+	if isErrTableDoesNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, c := range checks {
+		constraintName := toSnake(r.name, c.name)
+		if x, exists := existing[constraintName]; !exists || x.Validated {
+			continue
+		}
+
+		if err := p.validateConstraint(ctx, toSnake(r.name), constraintName); err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "check_violation" {
+				continue
+			}
+			return err
+		}
+	}
+
 	return nil
 }
 
 // EnsureForeignKeys creates foreign keys if they don't already exist.
 // This is a separate functon from EnsureTable as all tables have to exist first
 // in order to create foreign keys.
-func (p *Postgres) ensureForeignKeys(r *metaStruct) error {
+func (p *Postgres) ensureForeignKeys(ctx context.Context, r *metaStruct) error {
 	// ensure foreign keys
 	for _, f := range r.fields {
 		if f.foreignKeys != nil {
 			for _, fk := range f.foreignKeys {
 
-				refTbl, err := p.describeTable(toSnake(fk.structName))
+				refTbl, err := p.describeTable(ctx, toSnake(fk.structName))
 				if err != nil {
 					return err
 				}
 
 				// add unique index on referenced columns
 				if !refTbl.hasUniqueIndexByColumns(fk.fieldNames) {
-					if err := p.createIndex(toSnake(fk.structName, join(fk.fieldNames), "unique"), fk.structName, fk.fieldNames, true, !r.fields.hasPartitionedField()); err != nil {
+					if err := p.createIndex(ctx, toSnake(fk.structName, join(fk.fieldNames), "unique"), fk.structName, fk.fieldNames, true, !r.fields.hasPartitionedField(), indexStructTag{}); err != nil {
 						return err
 					}
 				}
 
 				// add missing foreign keys
-				exists, err := p.constraintExists(toSnake(r.name, f.name, "fk"))
+				exists, err := p.constraintExists(ctx, toSnake(r.name, f.name, "fk"))
 				if err != nil {
 					return err
 				}
 				if !exists {
-					if err := p.addForeignKey(toSnake(r.name), toSnake(r.name, f.name, "fk"), []string{f.name}, fk.structName, fk.fieldNames); err != nil {
+					// set null requires nullable columns, or deletes fail later on
+					if fk.onDelete == "set null" {
+						for _, name := range fk.columns(f.name) {
+							if x := r.fields.findByName(name); x != nil {
+								if _, nullable := parseColumnType(x.columnType()); !nullable {
+									return fmt.Errorf("%v: foreign key %v can't set not null column %v to null", r.name, f.name, name)
+								}
+							}
+						}
+					}
+
+					if err := p.addForeignKey(ctx, toSnake(r.name), toSnake(r.name, f.name, "fk"), fk.columns(f.name), fk); err != nil {
 						return err
 					}
 				}
@@ -377,7 +686,7 @@ func (p *Postgres) ensureForeignKeys(r *metaStruct) error {
 func (p *Postgres) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 	query = formatQuery(query)
 	start := time.Now()
-	r, err := p.db.ExecContext(ctx, query, args...)
+	r, err := p.sqlConn().ExecContext(ctx, query, args...)
 	p.logQuery(query, time.Since(start), args...)
 	return r, err
 }
@@ -386,7 +695,7 @@ func (p *Postgres) Exec(ctx context.Context, query string, args ...interface{})
 func (p *Postgres) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	query = formatQuery(query)
 	start := time.Now()
-	r, err := p.db.QueryContext(ctx, query, args...)
+	r, err := p.sqlConn().QueryContext(ctx, query, args...)
 	p.logQuery(query, time.Since(start), args...)
 	return r, err
 }
@@ -400,7 +709,7 @@ func (p *Postgres) Query(ctx context.Context, query string, args ...interface{})
 func (p *Postgres) QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
 	query = formatQuery(query)
 	start := time.Now()
-	r := p.db.QueryRowContext(ctx, query, args...)
+	r := p.sqlConn().QueryRowContext(ctx, query, args...)
 	p.logQuery(query, time.Since(start), args...)
 	return r
 }
@@ -415,7 +724,7 @@ func (p *Postgres) truncate(tableName string) error {
 	return err
 }
 
-func (p *Postgres) createTable(r *metaStruct) error {
+func (p *Postgres) createTable(ctx context.Context, r *metaStruct) error {
 	q := queryf()
 	q.Append("CREATE")
 
@@ -441,31 +750,77 @@ func (p *Postgres) createTable(r *metaStruct) error {
 			mustJoinIdentifiers(r.fields.primaryNames()))
 	}
 
+	// add check constraints
+	checks, err := r.fields.checks()
+	if err != nil {
+		return err
+	}
+	for _, c := range checks {
+		q.Appendf(", CONSTRAINT %v CHECK (%v)", mustIdentifier(toSnake(r.name, c.name)), c.expr)
+	}
+
 	q.Append(")")
 
-	// partition by range
-	partitionByRangeFields := make([]string, 0)
-	for _, f := range r.fields {
-		if f.partitionByRange != nil {
-			partitionByRangeFields = append(partitionByRangeFields, f.name)
-		}
+	// partition by range, list or hash
+	if strategy, fieldNames := r.fields.partitionBy(); strategy != "" {
+		q.Appendf("PARTITION BY %v (%v)", strategy, mustJoinIdentifiers(fieldNames))
 	}
-	if len(partitionByRangeFields) > 0 {
-		q.Appendf("PARTITION BY RANGE (%v)", mustJoinIdentifiers(partitionByRangeFields))
+
+	if p.plan != nil {
+		p.plan.createTable(r)
 	}
 
-	_, err := p.Exec(context.Background(), q.String())
-	return err
+	return p.execDDL(ctx, q.String(), fmt.Sprintf("table %v does not exist", r.name))
 }
 
-func (p *Postgres) addColumn(tableName, columnName, dataType string) error {
+func (p *Postgres) addColumn(ctx context.Context, tableName, columnName, dataType string) error {
 	queryf := "ALTER TABLE %v ADD COLUMN %v %v"
 	query := fmt.Sprintf(queryf, mustIdentifier(tableName), mustIdentifier(columnName), dataType)
-	_, err := p.Exec(context.Background(), query)
-	return err
+
+	if p.plan != nil {
+		p.plan.addColumn(tableName, columnName, dataType)
+	}
+
+	return p.execDDL(ctx, query, fmt.Sprintf("column %v.%v does not exist", tableName, columnName))
 }
 
-func (p *Postgres) createIndex(indexName, tableName string, columns []string, unique, concurrently bool) error {
+func (p *Postgres) alterColumnType(ctx context.Context, tableName, columnName, dataType, using, dflt string, dropNotNull bool) error {
+	column := mustIdentifier(columnName)
+
+	q := queryf()
+	q.Appendf("ALTER TABLE %v", mustIdentifier(tableName))
+	q.Appendf("ALTER COLUMN %v DROP DEFAULT,", column)
+	q.Appendf("ALTER COLUMN %v TYPE %v USING %v", column, dataType, using)
+
+	if dflt != "" {
+		q.Appendf(", ALTER COLUMN %v SET DEFAULT %v", column, dflt)
+	}
+
+	if dropNotNull {
+		q.Appendf(", ALTER COLUMN %v DROP NOT NULL", column)
+	}
+
+	return p.execDDL(ctx, q.String(), fmt.Sprintf("column %v.%v is widened to %v", tableName, columnName, dataType))
+}
+
+func (p *Postgres) renameColumn(ctx context.Context, tableName, oldColumnName, newColumnName string) error {
+	queryf := "ALTER TABLE %v RENAME COLUMN %v TO %v"
+	query := fmt.Sprintf(queryf, mustIdentifier(tableName), mustIdentifier(oldColumnName), mustIdentifier(newColumnName))
+
+	if p.plan != nil {
+		p.plan.renameColumn(tableName, oldColumnName, newColumnName)
+	}
+
+	return p.execDDL(ctx, query, fmt.Sprintf("column %v.%v was renamed to %v", tableName, oldColumnName, newColumnName))
+}
+
+func (p *Postgres) renameIndex(ctx context.Context, oldIndexName, newIndexName string) error {
+	queryf := "ALTER INDEX %v RENAME TO %v"
+	query := fmt.Sprintf(queryf, mustIdentifier(oldIndexName), mustIdentifier(newIndexName))
+	return p.execDDL(ctx, query, fmt.Sprintf("index %v was renamed to %v", oldIndexName, newIndexName))
+}
+
+func (p *Postgres) createIndex(ctx context.Context, indexName, tableName string, columns []string, unique, concurrently bool, tag indexStructTag) error {
 	q := queryf()
 	q.Append("CREATE")
 
@@ -480,65 +835,167 @@ func (p *Postgres) createIndex(indexName, tableName string, columns []string, un
 	}
 
 	q.Append(mustIdentifier(indexName), "ON", mustIdentifier(tableName))
-	q.Appendf("(%v)", mustJoinIdentifiers(columns))
 
-	_, err := p.Exec(context.Background(), q.String())
-	return err
+	if tag.method != "" {
+		q.Append("USING", indexMethod(tag.method))
+	}
+
+	if tag.expr != "" {
+		q.Appendf("((%v))", tag.expr)
+	} else {
+		q.Appendf("(%v)", mustJoinIndexColumns(columns, tag.order))
+	}
+
+	if tag.where != "" {
+		q.Append("WHERE", tag.where)
+	}
+
+	if p.plan != nil {
+		p.plan.createIndex(indexName, tableName, columns, unique, tag)
+	}
+
+	return p.execDDL(ctx, q.String(), fmt.Sprintf("index %v does not exist", indexName))
 }
 
-func (p *Postgres) addForeignKey(tableName, constraintName string, columns []string, referenceTable string, referenceColumns []string) error {
-	queryf := "ALTER TABLE %v ADD CONSTRAINT %v FOREIGN KEY (%v) REFERENCES %v (%v) MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE"
-	query := fmt.Sprintf(queryf, mustIdentifier(tableName), mustIdentifier(constraintName), mustJoinIdentifiers(columns), mustIdentifier(referenceTable), mustJoinIdentifiers(referenceColumns))
-	_, err := p.Exec(context.Background(), query)
-	return err
+func (p *Postgres) addForeignKey(ctx context.Context, tableName, constraintName string, columns []string, fk foreignKeyStructTag) error {
+	q := queryf()
+	q.Appendf("ALTER TABLE %v ADD CONSTRAINT %v FOREIGN KEY (%v) REFERENCES %v (%v) MATCH SIMPLE",
+		mustIdentifier(tableName), mustIdentifier(constraintName), mustJoinIdentifiers(columns),
+		mustIdentifier(fk.structName), mustJoinIdentifiers(fk.fieldNames))
+	q.Appendf("ON DELETE %v ON UPDATE CASCADE", fk.onDeleteAction())
+
+	if fk.deferrable {
+		q.Append("DEFERRABLE")
+	}
+
+	if fk.initiallyDeferred {
+		q.Append("INITIALLY DEFERRED")
+	}
+
+	query := q.String()
+
+	if p.plan != nil {
+		p.plan.addForeignKey(constraintName)
+	}
+
+	return p.execDDL(ctx, query, fmt.Sprintf("foreign key %v does not exist", constraintName))
+}
+
+func (p *Postgres) addCheck(ctx context.Context, tableName, constraintName, expr string, notValid bool) error {
+	q := queryf()
+	q.Appendf("ALTER TABLE %v ADD CONSTRAINT %v CHECK (%v)", mustIdentifier(tableName), mustIdentifier(constraintName), expr)
+
+	if notValid {
+		q.Append("NOT VALID")
+	}
+
+	if p.plan != nil {
+		p.plan.addCheck(tableName, constraintName, notValid)
+	}
+
+	return p.execDDL(ctx, q.String(), fmt.Sprintf("check %v does not exist", constraintName))
+}
+
+func (p *Postgres) validateConstraint(ctx context.Context, tableName, constraintName string) error {
+	queryf := "ALTER TABLE %v VALIDATE CONSTRAINT %v"
+	query := fmt.Sprintf(queryf, mustIdentifier(tableName), mustIdentifier(constraintName))
+	return p.execDDL(ctx, query, fmt.Sprintf("check %v is not validated", constraintName))
 }
 
-func (p *Postgres) addPrimaryKey(tableName, constraintName, indexName string) error {
+func (p *Postgres) addPrimaryKey(ctx context.Context, tableName, constraintName, indexName string) error {
 	queryf := "ALTER TABLE %v ADD CONSTRAINT %v PRIMARY KEY USING INDEX %v"
 	query := fmt.Sprintf(queryf,
 		mustIdentifier(tableName),
 		mustIdentifier(constraintName),
 		mustIdentifier(indexName))
 
-	_, err := p.Exec(context.Background(), query)
-	return err
+	if p.plan != nil {
+		p.plan.addPrimaryKey(tableName, constraintName, indexName)
+	}
+
+	return p.execDDL(ctx, query, fmt.Sprintf("primary key %v does not exist", constraintName))
 }
 
-func (p *Postgres) describeTable(tableName string) (*table, error) {
+func (p *Postgres) dropColumn(ctx context.Context, tableName, columnName string) error {
+	queryf := "ALTER TABLE %v DROP COLUMN IF EXISTS %v"
+	query := fmt.Sprintf(queryf, mustIdentifier(tableName), mustIdentifier(columnName))
+	return p.execDDL(ctx, query, fmt.Sprintf("column %v.%v is not used by struct", tableName, columnName))
+}
+
+func (p *Postgres) dropIndex(ctx context.Context, indexName string, concurrently bool) error {
+	q := queryf()
+	q.Append("DROP INDEX")
+
+	if concurrently {
+		q.Append("CONCURRENTLY")
+	}
+
+	q.Append("IF EXISTS", mustIdentifier(indexName))
+	return p.execDDL(ctx, q.String(), fmt.Sprintf("index %v is not used by struct", indexName))
+}
+
+func (p *Postgres) dropConstraint(ctx context.Context, tableName, constraintName string) error {
+	queryf := "ALTER TABLE %v DROP CONSTRAINT IF EXISTS %v"
+	query := fmt.Sprintf(queryf, mustIdentifier(tableName), mustIdentifier(constraintName))
+	return p.execDDL(ctx, query, fmt.Sprintf("constraint %v is not used by struct", constraintName))
+}
+
+func (p *Postgres) describeTable(ctx context.Context, tableName string) (*table, error) {
+	// without a database, only planned tables exist
+	if p.plan != nil && p.plan.offline {
+		if tbl, ok := p.plan.describeTable(tableName, nil); ok {
+			return tbl, nil
+		}
+		return nil, errTableDoesNotExist
+	}
+
 	// call describeTableIndexes first as it returns an actual error
 	// if this table doesn't exist.
 
-	indexes, err := p.describeTableIndexes(tableName)
+	indexes, err := p.describeTableIndexes(ctx, tableName)
+	if p.plan != nil && isErrTableDoesNotExist(err) {
+		if tbl, ok := p.plan.describeTable(tableName, nil); ok {
+			return tbl, nil
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	columns, err := p.describeTableColumns(tableName)
+	columns, err := p.describeTableColumns(ctx, tableName)
 	if err != nil {
 		return nil, err
 	}
 
-	return &table{
+	tbl := &table{
 		Name:    tableName,
 		Columns: columns,
 		Indexes: indexes,
-	}, nil
+	}
+
+	if p.plan != nil {
+		tbl, _ = p.plan.describeTable(tableName, tbl)
+	}
+
+	return tbl, nil
 }
 
-func (p *Postgres) describeTableIndexes(tableName string) ([]index, error) {
+func (p *Postgres) describeTableIndexes(ctx context.Context, tableName string) ([]index, error) {
 	// Copied this from Stackoverflow, lol. Is this really the only way?
+	// pg_get_indexdef omits the order of single columns, so DESC is read from indoption.
 	queryf := `
 SELECT
   i.relname :: text AS name,
   am.amname :: text AS type,
   ARRAY(
-    SELECT pg_get_indexdef(idx.indexrelid, k + 1, TRUE)
+    SELECT pg_get_indexdef(idx.indexrelid, k + 1, TRUE) || CASE WHEN idx.indoption[k] & 1 = 1 THEN ' DESC' ELSE '' END
     FROM generate_subscripts(idx.indkey, 1) AS k ORDER BY k
   ) AS columns,
   idx.indisunique AS is_unique,
   idx.indisprimary AS is_primary,
   (idx.indexprs IS NOT NULL) OR (idx.indkey::int[] @> array[0]) AS is_functional,
-  idx.indpred IS NOT NULL AS is_partial
+  idx.indpred IS NOT NULL AS is_partial,
+  COALESCE(pg_get_expr(idx.indpred, idx.indrelid, TRUE), '') AS predicate
 FROM pg_index AS idx
 JOIN pg_class AS i ON i.oid = idx.indexrelid
 JOIN pg_am AS am ON i.relam = am.oid
@@ -546,7 +1003,7 @@ JOIN pg_namespace AS ns ON i.relnamespace = ns.OID
 WHERE idx.indrelid = %v :: REGCLASS`
 
 	query := fmt.Sprintf(queryf, QuoteLiteral(tableName))
-	rows, err := p.Query(context.Background(), query)
+	rows, err := p.Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -562,7 +1019,7 @@ WHERE idx.indrelid = %v :: REGCLASS`
 
 		// unquote identifiers
 		i.Name = unquoteIdentifier(i.Name)
-		i.Columns = unquoteIdentifiers(i.Columns)
+		i.Columns = unquoteIndexColumns(i.Columns)
 
 		is = append(is, *i)
 	}
@@ -574,10 +1031,10 @@ WHERE idx.indrelid = %v :: REGCLASS`
 	return is, nil
 }
 
-func (p *Postgres) describeTableColumns(tableName string) ([]column, error) {
+func (p *Postgres) describeTableColumns(ctx context.Context, tableName string) ([]column, error) {
 	queryf := "SELECT column_name, is_nullable, data_type FROM information_schema.columns WHERE table_name = %v"
 	query := fmt.Sprintf(queryf, QuoteLiteral(tableName))
-	rows, err := p.Query(context.Background(), query)
+	rows, err := p.Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -604,10 +1061,129 @@ func (p *Postgres) describeTableColumns(tableName string) ([]column, error) {
 	return cs, nil
 }
 
-func (p *Postgres) constraintExists(constraintName string) (bool, error) {
+// check is a check constraint as described by pg_constraint
+type check struct {
+	Definition string // Definition is the output of pg_get_constraintdef, i.e. `CHECK ((col > 0))`
+	Validated  bool
+}
+
+// hasDefinition returns true if the check has the definition, as rendered by
+// pg_get_constraintdef, regardless of whether the check is validated.
+func (x check) hasDefinition(definition string) bool {
+	return strings.TrimSuffix(x.Definition, " NOT VALID") == definition
+}
+
+// describeChecks returns the check constraints of a table, by name
+func (p *Postgres) describeChecks(ctx context.Context, tableName string) (map[string]check, error) {
+	out := make(map[string]check)
+	if p.plan != nil {
+		for name, x := range p.plan.checks[toSnake(tableName)] {
+			out[name] = x
+		}
+		if p.plan.offline {
+			return out, nil
+		}
+	}
+
+	queryf := "SELECT conname :: text, pg_get_constraintdef(oid), convalidated FROM pg_constraint WHERE conrelid = %v :: REGCLASS AND contype = 'c'"
+	query := fmt.Sprintf(queryf, QuoteLiteral(tableName))
+	rows, err := p.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var x check
+		if err := rows.Scan(&name, &x.Definition, &x.Validated); err != nil {
+			return nil, err
+		}
+		out[name] = x
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// foreignKey is a foreign key constraint as described by pg_constraint
+type foreignKey struct {
+	Columns           []string
+	OnDelete          string // OnDelete is the action, i.e. `CASCADE`
+	Deferrable        bool
+	InitiallyDeferred bool
+}
+
+// foreignKeyDeleteActions maps pg_constraint.confdeltype to ON DELETE actions
+var foreignKeyDeleteActions = map[string]string{
+	"a": "NO ACTION",
+	"r": "RESTRICT",
+	"c": "CASCADE",
+	"n": "SET NULL",
+	"d": "SET DEFAULT",
+}
+
+// describeForeignKeys returns the foreign keys of a table, by name
+func (p *Postgres) describeForeignKeys(ctx context.Context, tableName string) (map[string]foreignKey, error) {
+	out := make(map[string]foreignKey)
+	if p.plan != nil && p.plan.offline {
+		return out, nil
+	}
+
+	queryf := `
+SELECT
+  con.conname :: text,
+  con.confdeltype :: text,
+  con.condeferrable,
+  con.condeferred,
+  ARRAY(
+    SELECT a.attname :: text
+    FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, n)
+    JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+    ORDER BY k.n
+  )
+FROM pg_constraint con
+WHERE con.conrelid = %v :: REGCLASS AND con.contype = 'f'
+`
+	query := fmt.Sprintf(queryf, QuoteLiteral(tableName))
+	rows, err := p.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, onDelete string
+		var x foreignKey
+		if err := rows.Scan(&name, &onDelete, &x.Deferrable, &x.InitiallyDeferred, pq.Array(&x.Columns)); err != nil {
+			return nil, err
+		}
+		x.OnDelete = foreignKeyDeleteActions[onDelete]
+		out[name] = x
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (p *Postgres) constraintExists(ctx context.Context, constraintName string) (bool, error) {
+	if p.plan != nil && p.plan.constraints[toSnake(constraintName)] {
+		return true, nil
+	}
+
+	if p.plan != nil && p.plan.offline {
+		return false, nil
+	}
+
 	queryf := "SELECT 1 FROM information_schema.constraint_column_usage WHERE constraint_name = %v"
 	query := fmt.Sprintf(queryf, QuoteLiteral(constraintName))
-	row := p.QueryRow(context.Background(), query)
+	row := p.QueryRow(ctx, query)
 
 	var exists int
 	err := row.Scan(&exists)
@@ -621,9 +1197,15 @@ func (p *Postgres) constraintExists(constraintName string) (bool, error) {
 var (
 	ErrNoLock      = fmt.Errorf("no lock")
 	ErrNotUnlocked = fmt.Errorf("not unlocked")
+
+	// ErrMigrateLockTimeout is returned by Migrate if it was unable
+	// to acquire the advisory lock within maxAdvisoryLockAttemtps.
+	ErrMigrateLockTimeout = fmt.Errorf("migrate: unable to obtain advisory lock")
 )
 
-func (p *Postgres) waitForAdvisoryLock(key int) {
+// waitForAdvisoryLock retries to acquire a lock until it succeeds, ctx is done,
+// or maxAdvisoryLockAttemtps is exceeded, in which case it returns ErrMigrateLockTimeout.
+func (p *Postgres) waitForAdvisoryLock(ctx context.Context, key int) error {
 	d := &backoff.Backoff{
 		Min:    3 * time.Second,
 		Max:    15 * time.Second,
@@ -632,22 +1214,26 @@ func (p *Postgres) waitForAdvisoryLock(key int) {
 	}
 
 	for {
-		if err := p.advisoryLock(key); err == nil {
-			return
+		if err := p.advisoryLock(ctx, key); err == nil {
+			return nil
 		}
 
 		if d.Attempt() > float64(maxAdvisoryLockAttemtps) {
-			panic("unable to obtain advisory lock")
+			return ErrMigrateLockTimeout
 		}
 
-		time.Sleep(d.Duration())
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d.Duration()):
+		}
 	}
 }
 
-func (p *Postgres) advisoryLock(key int) error {
+func (p *Postgres) advisoryLock(ctx context.Context, key int) error {
 	queryf := "SELECT pg_try_advisory_lock(%v)"
 	query := fmt.Sprintf(queryf, key)
-	row := p.QueryRow(context.Background(), query)
+	row := p.QueryRow(ctx, query)
 
 	var locked postgresBool
 	if err := row.Scan(&locked); err != nil {
@@ -703,7 +1289,14 @@ func (p *Postgres) isMinVersion(version int) (bool, error) {
 		return false, err
 	}
 
-	return x >= version*1000, nil
+	return isMinServerVersion(x, version), nil
+}
+
+// isMinServerVersion reports whether server_version_num is at least the major version.
+// Since Postgres 10 server_version_num is major * 10000 + minor, i.e. 140002 for 14.2.
+// Before, it was major * 10000 + second major * 100 + minor, i.e. 90605 for 9.6.5.
+func isMinServerVersion(serverVersionNum, version int) bool {
+	return serverVersionNum >= version*10000
 }
 
 // scan calls row.Scan and returns a slice of pointers to interfaces
@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"strconv"
 	"testing"
 	"time"
@@ -29,7 +30,7 @@ func TestGet(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestGetTable_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestGetTable_Struct{})))
 
 	// create some records
 	_, err = db.Exec(context.Background(), "INSERT INTO test_get_table_struct (col1, col2) VALUES ('1', 'bar'), ('2', 'bar'), ('3', 'abc')")
@@ -60,7 +61,7 @@ func BenchmarkGet(b *testing.B) {
 	require.NoError(b, err)
 
 	// create table
-	require.NoError(b, db.ensureTable(mustNewMetaStruct(&BenchmarkGet_Struct{})))
+	require.NoError(b, db.ensureTable(context.Background(), mustNewMetaStruct(&BenchmarkGet_Struct{})))
 
 	// create a new record
 	s := &BenchmarkGet_Struct{
@@ -81,7 +82,7 @@ func BenchmarkGet_Plain(b *testing.B) {
 	require.NoError(b, err)
 
 	// create table
-	require.NoError(b, db.ensureTable(mustNewMetaStruct(&BenchmarkGet_Struct{})))
+	require.NoError(b, db.ensureTable(context.Background(), mustNewMetaStruct(&BenchmarkGet_Struct{})))
 
 	// create a new record
 	s := &BenchmarkGet_Struct{
@@ -114,7 +115,7 @@ func TestGet_CompositePrimaryKey(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestGetTable_CompositePrimaryKey_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestGetTable_CompositePrimaryKey_Struct{})))
 
 	// create some records
 	_, err = db.Exec(context.Background(), "INSERT INTO test_get_table_composite_primary_key_struct (col1, col2, col3) VALUES ('1', '2', 'bar'), ('3', '4', 'bar'), ('5', '6', 'abc')")
@@ -137,6 +138,40 @@ func TestGet_CompositePrimaryKey(t *testing.T) {
 	log.Equal(t, "test_data/test_get_composite_primary_key.txt")
 }
 
+type TestGetMany_CompositePrimaryKey_Struct struct {
+	Col1 string `db:"pk(composite=[Col1, Col2])"`
+	Col2 int
+	Col3 string
+}
+
+func TestGetMany_CompositePrimaryKey(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// create table
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestGetMany_CompositePrimaryKey_Struct{})))
+
+	// create some records
+	_, err = db.Exec(context.Background(), "INSERT INTO test_get_many_composite_primary_key_struct (col1, col2, col3) VALUES ('1', 2, 'foo'), ('3', 4, 'bar'), ('5', 6, 'abc')")
+	require.NoError(t, err)
+
+	// get records, one of them doesn't exist
+	s := []TestGetMany_CompositePrimaryKey_Struct{
+		{Col1: "5", Col2: 6},
+		{Col1: "7", Col2: 8},
+		{Col1: "1", Col2: 2},
+	}
+	err = db.GetMany(context.Background(), &s)
+	require.Equal(t, &MissingRecordsError{Struct: "TestGetMany_CompositePrimaryKey_Struct", Indexes: []int{1}}, err)
+
+	expect := []TestGetMany_CompositePrimaryKey_Struct{
+		{Col1: "5", Col2: 6, Col3: "abc"},
+		{Col1: "7", Col2: 8},
+		{Col1: "1", Col2: 2, Col3: "foo"},
+	}
+	require.Equal(t, expect, s)
+}
+
 type TestInsert_Struct struct {
 	Col1 string `db:"pk"`
 	Col2 string
@@ -152,7 +187,7 @@ func TestInsert(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestInsert_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestInsert_Struct{})))
 
 	// create a new record
 	s := &TestInsert_Struct{
@@ -192,7 +227,7 @@ func BenchmarkInsert(b *testing.B) {
 	require.NoError(b, err)
 
 	// create table
-	require.NoError(b, db.ensureTable(mustNewMetaStruct(&BenchmarkInsert_Struct{})))
+	require.NoError(b, db.ensureTable(context.Background(), mustNewMetaStruct(&BenchmarkInsert_Struct{})))
 
 	// create a new record
 	s := &BenchmarkInsert_Struct{
@@ -212,7 +247,7 @@ func BenchmarkInsert_Plain(b *testing.B) {
 	require.NoError(b, err)
 
 	// create table
-	require.NoError(b, db.ensureTable(mustNewMetaStruct(&BenchmarkInsert_Struct{})))
+	require.NoError(b, db.ensureTable(context.Background(), mustNewMetaStruct(&BenchmarkInsert_Struct{})))
 
 	b.ResetTimer()
 
@@ -237,7 +272,7 @@ func TestInsert_CompositePrimaryKey(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestInsert_CompositePrimaryKey_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestInsert_CompositePrimaryKey_Struct{})))
 
 	// create a new record
 	s := &TestInsert_CompositePrimaryKey_Struct{
@@ -283,7 +318,7 @@ func TestInsert_WithFieldMask(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestInsert_WithFieldMask_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestInsert_WithFieldMask_Struct{})))
 
 	// create a new record
 	s := &TestInsert_WithFieldMask_Struct{
@@ -313,6 +348,46 @@ func TestInsert_WithFieldMask(t *testing.T) {
 	log.Equal(t, "test_data/test_insert_with_fieldmask.txt")
 }
 
+type TestInsertMany_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 string
+	Col3 map[string]string
+}
+
+func TestInsertMany(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// create table
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestInsertMany_Struct{})))
+
+	// create new records
+	s := []TestInsertMany_Struct{
+		{Col1: "1", Col2: "foo", Col3: map[string]string{"a": "b"}},
+		{Col1: "2", Col2: "bar"},
+		{Col1: "3", Col2: "<not saved>"},
+	}
+	batch1, batch2 := s[0:2], s[2:3]
+	require.NoError(t, db.InsertMany(context.Background(), &batch1))
+	require.NoError(t, db.InsertMany(context.Background(), &batch2, "Col1"))
+
+	// read records from database
+	x1 := &TestInsertMany_Struct{Col1: "1"}
+	require.NoError(t, db.Get(context.Background(), x1))
+	require.Equal(t, &s[0], x1)
+
+	x2 := &TestInsertMany_Struct{Col1: "2"}
+	require.NoError(t, db.Get(context.Background(), x2))
+	require.Equal(t, &s[1], x2)
+
+	x3 := &TestInsertMany_Struct{Col1: "3"}
+	require.NoError(t, db.Get(context.Background(), x3))
+	require.Equal(t, &TestInsertMany_Struct{Col1: "3"}, x3)
+
+	// try to insert again
+	requirePQError(t, db.InsertMany(context.Background(), &s), "unique_violation")
+}
+
 type TestUpdate_Struct struct {
 	Col1 string `db:"pk"`
 	Col2 string
@@ -328,7 +403,7 @@ func TestUpdate(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestUpdate_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestUpdate_Struct{})))
 
 	// create initial record
 	_, err = db.Exec(context.Background(), "INSERT INTO test_update_struct (col1, col2, col3) VALUES ('1', 'a', 'b'), ('2', 'c', 'd'), ('3', 'e', 'f')")
@@ -374,7 +449,7 @@ func TestUpdate_CompositePrimaryKey(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestUpdate_CompositePrimaryKey_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestUpdate_CompositePrimaryKey_Struct{})))
 
 	// create initial record
 	_, err = db.Exec(context.Background(), "INSERT INTO test_update_composite_primary_key_struct (col1, col2, col3) VALUES ('1', 'a', 'b'), ('2', 'c', 'd'), ('3', 'e', 'f')")
@@ -421,7 +496,7 @@ func TestUpdate_WithFieldMask(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestUpdate_WithFieldMask_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestUpdate_WithFieldMask_Struct{})))
 
 	// create initial record
 	_, err = db.Exec(context.Background(), "INSERT INTO test_update_with_field_mask_struct (col1, col2, col3) VALUES ('1', 'a', 'b'), ('2', 'c', 'd'), ('3', 'e', 'f')")
@@ -452,6 +527,48 @@ func TestUpdate_WithFieldMask(t *testing.T) {
 	log.Equal(t, "test_data/test_update_with_field_mask.txt")
 }
 
+type TestUpdateWhereAndDeleteWhere_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 string
+	Col3 string
+}
+
+func TestUpdateWhereAndDeleteWhere(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// create table
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestUpdateWhereAndDeleteWhere_Struct{})))
+
+	// create some records
+	_, err = db.Exec(context.Background(), "INSERT INTO test_update_where_and_delete_where_struct (col1, col2, col3) VALUES ('1', 'a', 'x'), ('2', 'a', 'y'), ('3', 'b', 'z')")
+	require.NoError(t, err)
+
+	// update records
+	n, err := db.UpdateWhere(context.Background(),
+		&TestUpdateWhereAndDeleteWhere_Struct{Col2: "<not saved>", Col3: "foo"},
+		Query("Col2 = $1", "a"), "Col3")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+
+	s := []TestUpdateWhereAndDeleteWhere_Struct{}
+	require.NoError(t, db.Filter(context.Background(), &s, Query("Col3 = $1", "foo").Asc("Col1")))
+	require.Equal(t, []TestUpdateWhereAndDeleteWhere_Struct{{"1", "a", "foo"}, {"2", "a", "foo"}}, s)
+
+	// empty queries are refused
+	_, err = db.DeleteWhere(context.Background(), &TestUpdateWhereAndDeleteWhere_Struct{}, Query(""))
+	require.Error(t, err)
+
+	// delete records
+	n, err = db.DeleteWhere(context.Background(), &TestUpdateWhereAndDeleteWhere_Struct{}, Query("Col2 = $1", "b"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	n, err = db.DeleteWhere(context.Background(), &TestUpdateWhereAndDeleteWhere_Struct{}, QueryAll())
+	require.NoError(t, err)
+	require.Equal(t, int64(2), n)
+}
+
 type TestSave_Insert_Struct struct {
 	Col1 string `db:"pk"`
 	Col2 string
@@ -467,7 +584,7 @@ func TestSave_Insert(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestSave_Insert_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestSave_Insert_Struct{})))
 
 	// create a new record
 	s := &TestSave_Insert_Struct{
@@ -509,7 +626,7 @@ func TestSave_Insert_CompositePrimaryKey(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestSave_Insert_CompositePrimaryKey_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestSave_Insert_CompositePrimaryKey_Struct{})))
 
 	// create a new record
 	s := &TestSave_Insert_CompositePrimaryKey_Struct{
@@ -552,7 +669,7 @@ func TestSave_Update(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestSave_Update_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestSave_Update_Struct{})))
 
 	// create initial record
 	_, err = db.Exec(context.Background(), "INSERT INTO test_save_update_struct (col1, col2, col3) VALUES ('1', 'a', 'b'), ('2', 'c', 'd'), ('3', 'e', 'f')")
@@ -598,7 +715,7 @@ func TestSave_Update_CompositePrimaryKey(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestSave_Update_CompositePrimaryKey_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestSave_Update_CompositePrimaryKey_Struct{})))
 
 	// create initial record
 	_, err = db.Exec(context.Background(), "INSERT INTO test_save_update_composite_primary_key_struct (col1, col2, col3) VALUES ('1', 'a', 'b'), ('2', 'c', 'd'), ('3', 'e', 'f')")
@@ -645,7 +762,7 @@ func TestSave_Insert_WithFieldMask(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestSave_Insert_WithFieldMask_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestSave_Insert_WithFieldMask_Struct{})))
 
 	// create a new record
 	s := &TestSave_Insert_WithFieldMask_Struct{
@@ -687,7 +804,7 @@ func TestSave_Update_WithFieldMask(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestSave_Update_WithFieldMask_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestSave_Update_WithFieldMask_Struct{})))
 
 	// create initial record
 	_, err = db.Exec(context.Background(), "INSERT INTO test_save_update_with_field_mask_struct (col1, col2, col3) VALUES ('1', 'a', 'b'), ('2', 'c', 'd'), ('3', 'e', 'f')")
@@ -718,6 +835,46 @@ func TestSave_Update_WithFieldMask(t *testing.T) {
 	log.Equal(t, "test_data/test_save_update_with_field_mask.txt")
 }
 
+type TestSaveMany_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 string
+	Col3 string
+}
+
+func TestSaveMany(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// create table
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestSaveMany_Struct{})))
+
+	// create initial record
+	_, err = db.Exec(context.Background(), "INSERT INTO test_save_many_struct (col1, col2, col3) VALUES ('1', 'a', 'b')")
+	require.NoError(t, err)
+
+	// update one and create two records
+	s := []TestSaveMany_Struct{
+		{Col1: "1", Col2: "<not saved>", Col3: "x"},
+		{Col1: "2", Col2: "<not saved>", Col3: "y"},
+		{Col1: "3", Col2: "<not saved>", Col3: "z"},
+	}
+	require.NoError(t, db.SaveMany(context.Background(), &s, "Col1", "Col3"))
+
+	expect := []TestSaveMany_Struct{
+		{Col1: "1", Col2: "a", Col3: "x"},
+		{Col1: "2", Col2: "", Col3: "y"},
+		{Col1: "3", Col2: "", Col3: "z"},
+	}
+	require.Equal(t, expect, s)
+
+	// read records from database
+	for _, x := range expect {
+		s2 := &TestSaveMany_Struct{Col1: x.Col1}
+		require.NoError(t, db.Get(context.Background(), s2))
+		require.Equal(t, &x, s2)
+	}
+}
+
 type TestDelete_Struct struct {
 	Col1 string `db:"pk"`
 	Col2 string
@@ -732,7 +889,7 @@ func TestDelete(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestDelete_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestDelete_Struct{})))
 
 	// create a record
 	_, err = db.Exec(context.Background(), "INSERT INTO test_delete_struct (col1, col2) VALUES ('1', 'a'), ('2', 'b'), ('3', 'c')")
@@ -751,7 +908,7 @@ func TestDelete(t *testing.T) {
 	require.NoError(t, db.Get(context.Background(), x1))
 
 	x2 := &TestDelete_Struct{Col1: "2"}
-	require.Error(t, db.Get(context.Background(), x2))
+	require.True(t, errors.Is(db.Get(context.Background(), x2), ErrNotFound))
 
 	x3 := &TestDelete_Struct{Col1: "3"}
 	require.NoError(t, db.Get(context.Background(), x3))
@@ -772,7 +929,7 @@ func TestDelete_CompositePrimaryKey(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestDelete_CompositePrimaryKey_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestDelete_CompositePrimaryKey_Struct{})))
 
 	// create a record
 	_, err = db.Exec(context.Background(), "INSERT INTO test_delete_composite_primary_key_struct (col1, col2, col3) VALUES ('1', 'a', 'b'), ('2', 'c', 'd'), ('3', 'e', 'f')")
@@ -813,7 +970,7 @@ func TestFilter(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestFilter_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestFilter_Struct{})))
 
 	// create a record
 	_, err = db.Exec(context.Background(), "INSERT INTO test_filter_struct (col1, col2, col3) VALUES ('1', 'a', 'x'), ('2', 'c', 'y'), ('3', 'e', 'x')")
@@ -830,6 +987,126 @@ func TestFilter(t *testing.T) {
 	log.Equal(t, "test_data/test_filter.txt")
 }
 
+type TestFilterIter_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 string
+	Col3 string
+}
+
+func TestFilterIter(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// create table
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestFilterIter_Struct{})))
+
+	// create more records than the default QueryLimit
+	for i := 0; i < QueryLimit+5; i++ {
+		require.NoError(t, db.Insert(context.Background(), &TestFilterIter_Struct{strconv.Itoa(i), "a", "x"}))
+	}
+	require.NoError(t, db.Insert(context.Background(), &TestFilterIter_Struct{"y", "b", "y"}))
+
+	// iterate over all matching records
+	it, err := db.FilterIter(context.Background(), &TestFilterIter_Struct{}, Query("Col3 = $1", "x").Asc("Col1"))
+	require.NoError(t, err)
+
+	n := 0
+	for it.Next() {
+		s := &TestFilterIter_Struct{}
+		require.NoError(t, it.Scan(s))
+		require.Equal(t, "a", s.Col2)
+		n++
+	}
+	require.NoError(t, it.Err())
+	require.NoError(t, it.Close())
+	require.Equal(t, QueryLimit+5, n)
+
+	// invalid untrusted query
+	_, err = db.FilterIter(context.Background(), &TestFilterIter_Struct{}, UntrustedQuery("Col3 = $1", "x"))
+	require.Error(t, err)
+}
+
+type TestFilter_Pagination_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 int
+}
+
+func TestFilter_Pagination(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// create table
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestFilter_Pagination_Struct{})))
+
+	// create some records
+	_, err = db.Exec(context.Background(), "INSERT INTO test_filter_pagination_struct (col1, col2) VALUES ('a', 1), ('b', 2), ('c', 2), ('d', 3), ('e', 4)")
+	require.NoError(t, err)
+
+	// page through records, two at a time
+	pages := [][]TestFilter_Pagination_Struct{}
+	token := ""
+	for {
+		s := []TestFilter_Pagination_Struct{}
+		q := UntrustedQuery("Col2 > $1", 1).Whitelist("Col2").Desc("Col2").Limit(2).After(token)
+		require.NoError(t, db.Filter(context.Background(), &s, q))
+		pages = append(pages, s)
+
+		token = q.NextPageToken()
+		if token == "" {
+			break
+		}
+	}
+
+	expect := [][]TestFilter_Pagination_Struct{
+		{{"e", 4}, {"d", 3}},
+		{{"b", 2}, {"c", 2}},
+		{},
+	}
+	require.Equal(t, expect, pages)
+
+	// tampered token
+	s := []TestFilter_Pagination_Struct{}
+	err = db.Filter(context.Background(), &s, Query("Col2 > $1", 1).Desc("Col2").After("foo"))
+	require.Equal(t, ErrInvalidPageToken, err)
+}
+
+type TestCountAndExists_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 string
+}
+
+func TestCountAndExists(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// create table
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestCountAndExists_Struct{})))
+
+	// create some records
+	_, err = db.Exec(context.Background(), "INSERT INTO test_count_and_exists_struct (col1, col2) VALUES ('1', 'a'), ('2', 'a'), ('3', 'b')")
+	require.NoError(t, err)
+
+	count, err := db.Count(context.Background(), &TestCountAndExists_Struct{}, UntrustedQuery("Col2 = $1", "a").Whitelist("Col2").Limit(1))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	count, err = db.Count(context.Background(), &TestCountAndExists_Struct{}, Query("Col2 = $1", "x"))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
+
+	exists, err := db.Exists(context.Background(), &TestCountAndExists_Struct{}, Query("Col2 = $1", "b"))
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	exists, err = db.Exists(context.Background(), &TestCountAndExists_Struct{}, Query("Col2 = $1", "x"))
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// whitelist doesn't match
+	_, err = db.Count(context.Background(), &TestCountAndExists_Struct{}, UntrustedQuery("Col1 = $1", "a").Whitelist("Col2"))
+	require.Error(t, err)
+}
+
 type BenchmarkFilter_Struct struct {
 	Col1 string `db:"pk"`
 	Col2 string `db:"index"`
@@ -840,7 +1117,7 @@ func BenchmarkFilter(b *testing.B) {
 	require.NoError(b, err)
 
 	// create table
-	require.NoError(b, db.ensureTable(mustNewMetaStruct(&BenchmarkFilter_Struct{})))
+	require.NoError(b, db.ensureTable(context.Background(), mustNewMetaStruct(&BenchmarkFilter_Struct{})))
 
 	// create a bunch of new records
 	for i := 0; i < 25; i++ {
@@ -866,7 +1143,7 @@ func BenchmarkFilter_Plain(b *testing.B) {
 	require.NoError(b, err)
 
 	// create table
-	require.NoError(b, db.ensureTable(mustNewMetaStruct(&BenchmarkFilter_Struct{})))
+	require.NoError(b, db.ensureTable(context.Background(), mustNewMetaStruct(&BenchmarkFilter_Struct{})))
 
 	// create a bunch of new records
 	for i := 0; i < 25; i++ {
@@ -907,10 +1184,10 @@ func TestEnsureTable_PrimaryKeys(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_PrimaryKeys_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_PrimaryKeys_Struct{})))
 
 	// make sure table was created correctly
-	tbl, err := db.describeTable("test_ensure_table_primary_keys_struct")
+	tbl, err := db.describeTable(context.Background(), "test_ensure_table_primary_keys_struct")
 	require.NoError(t, err)
 
 	expectTable := &table{
@@ -926,7 +1203,7 @@ func TestEnsureTable_PrimaryKeys(t *testing.T) {
 	require.Equal(t, expectTable, tbl)
 
 	// table already exists
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_PrimaryKeys_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_PrimaryKeys_Struct{})))
 
 	log.Equal(t, "test_data/test_ensure_table_primary_keys.txt")
 }
@@ -946,10 +1223,10 @@ func TestEnsureTable_CompositePrimaryKeys(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_CompositePrimaryKeys_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_CompositePrimaryKeys_Struct{})))
 
 	// make sure table was created correctly
-	tbl, err := db.describeTable("test_ensure_table_composite_primary_keys_struct")
+	tbl, err := db.describeTable(context.Background(), "test_ensure_table_composite_primary_keys_struct")
 	require.NoError(t, err)
 
 	expectTable := &table{
@@ -966,7 +1243,7 @@ func TestEnsureTable_CompositePrimaryKeys(t *testing.T) {
 	require.Equal(t, expectTable, tbl)
 
 	// table already exists
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_CompositePrimaryKeys_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_CompositePrimaryKeys_Struct{})))
 
 	log.Equal(t, "test_data/test_ensure_table_composite_primary_keys.txt")
 }
@@ -985,10 +1262,10 @@ func TestEnsureTable_UniqueIndex(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_UniqueIndex_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_UniqueIndex_Struct{})))
 
 	// make sure table was created correctly
-	tbl, err := db.describeTable("test_ensure_table_unique_index_struct")
+	tbl, err := db.describeTable(context.Background(), "test_ensure_table_unique_index_struct")
 	require.NoError(t, err)
 
 	expectTable := &table{
@@ -1004,7 +1281,7 @@ func TestEnsureTable_UniqueIndex(t *testing.T) {
 	require.Equal(t, expectTable, tbl)
 
 	// table already exists
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_UniqueIndex_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_UniqueIndex_Struct{})))
 
 	log.Equal(t, "test_data/test_ensure_table_unique_index.txt")
 }
@@ -1024,10 +1301,10 @@ func TestEnsureTable_CompositeUniqueIndex(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_CompositeUniqueIndex_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_CompositeUniqueIndex_Struct{})))
 
 	// make sure table was created correctly
-	tbl, err := db.describeTable("test_ensure_table_composite_unique_index_struct")
+	tbl, err := db.describeTable(context.Background(), "test_ensure_table_composite_unique_index_struct")
 	require.NoError(t, err)
 
 	expectTable := &table{
@@ -1045,7 +1322,7 @@ func TestEnsureTable_CompositeUniqueIndex(t *testing.T) {
 	require.Equal(t, expectTable, tbl)
 
 	// table already exists
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_CompositeUniqueIndex_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_CompositeUniqueIndex_Struct{})))
 
 	log.Equal(t, "test_data/test_ensure_table_composite_unique_index.txt")
 }
@@ -1064,10 +1341,10 @@ func TestEnsureTable_Index(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_Index_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_Index_Struct{})))
 
 	// make sure table was created correctly
-	tbl, err := db.describeTable("test_ensure_table_index_struct")
+	tbl, err := db.describeTable(context.Background(), "test_ensure_table_index_struct")
 	require.NoError(t, err)
 
 	expectTable := &table{
@@ -1083,7 +1360,7 @@ func TestEnsureTable_Index(t *testing.T) {
 	require.Equal(t, expectTable, tbl)
 
 	// table already exists
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_Index_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_Index_Struct{})))
 
 	log.Equal(t, "test_data/test_ensure_table_index.txt")
 }
@@ -1103,10 +1380,10 @@ func TestEnsureTable_CompositeIndex(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_CompositeIndex_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_CompositeIndex_Struct{})))
 
 	// make sure table was created correctly
-	tbl, err := db.describeTable("test_ensure_table_composite_index_struct")
+	tbl, err := db.describeTable(context.Background(), "test_ensure_table_composite_index_struct")
 	require.NoError(t, err)
 
 	expectTable := &table{
@@ -1124,11 +1401,246 @@ func TestEnsureTable_CompositeIndex(t *testing.T) {
 	require.Equal(t, expectTable, tbl)
 
 	// table already exists
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_CompositeIndex_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_CompositeIndex_Struct{})))
 
 	log.Equal(t, "test_data/test_ensure_table_composite_index.txt")
 }
 
+type TestEnsureTable_IndexMethodAndOrder_Struct struct {
+	Col1 string `db:"index(method=hash)"`
+	Col2 string `db:"unique(name=foobar, order=desc, composite=[Col3])"`
+	Col3 string
+	Col4 map[string]string `db:"index(method=gin)"`
+	Col5 string            `db:"index(order=desc)"`
+}
+
+func TestEnsureTable_IndexMethodAndOrder(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// create table
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_IndexMethodAndOrder_Struct{})))
+
+	// make sure indexes were created correctly
+	tbl, err := db.describeTable(context.Background(), "test_ensure_table_index_method_and_order_struct")
+	require.NoError(t, err)
+
+	require.True(t, tbl.hasIndex(index{Name: "test_ensure_table_index_method_and_order_struct_col1_index", Type: "hash", Columns: []string{"col1"}}))
+	require.True(t, tbl.hasIndex(index{Name: "test_ensure_table_index_method_and_order_struct_foobar", Type: "btree", Columns: []string{"col2 DESC", "col3 DESC"}, IsUnique: true}))
+	require.True(t, tbl.hasIndex(index{Name: "test_ensure_table_index_method_and_order_struct_col4_index", Type: "gin", Columns: []string{"col4"}}))
+	require.True(t, tbl.hasIndex(index{Name: "test_ensure_table_index_method_and_order_struct_col5_index", Type: "btree", Columns: []string{"col5 DESC"}}))
+	require.Len(t, tbl.Indexes, 4)
+
+	// indexes already exist, including descending indexes
+	log := &testLogger{}
+	db.Logger = log
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_IndexMethodAndOrder_Struct{})))
+	require.NotContains(t, log.writer.String(), "CREATE")
+}
+
+type TestEnsureTable_PartialAndExpressionIndex_Struct struct {
+	Email     string     `db:"unique(expr='lower(email)')"`
+	DeletedAt *time.Time `db:"index(where='deleted_at IS NULL')"`
+}
+
+func TestEnsureTable_PartialAndExpressionIndex(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// create table
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_PartialAndExpressionIndex_Struct{})))
+
+	// make sure indexes were created correctly
+	tbl, err := db.describeTable(context.Background(), "test_ensure_table_partial_and_expression_index_struct")
+	require.NoError(t, err)
+
+	require.True(t, tbl.hasIndex(index{Name: "test_ensure_table_partial_and_expression_index_struct_email_unique", Type: "btree", Columns: []string{"lower(email)"}, IsUnique: true, IsFunctional: true}))
+	require.True(t, tbl.hasIndex(index{Name: "test_ensure_table_partial_and_expression_index_struct_deleted_at_index", Type: "btree", Columns: []string{"deleted_at"}, IsPartial: true, Where: "deleted_at IS NULL"}))
+	require.Len(t, tbl.Indexes, 2)
+
+	// indexes already exist
+	log := &testLogger{}
+	db.Logger = log
+	r := mustNewMetaStruct(&TestEnsureTable_PartialAndExpressionIndex_Struct{})
+	require.NoError(t, db.ensureTable(context.Background(), r))
+	require.NotContains(t, log.writer.String(), "CREATE")
+
+	d, err := db.drift(context.Background(), r)
+	require.NoError(t, err)
+	require.False(t, d.hasDrift())
+
+	// changed predicates and expressions are not migrated, but reported by Drift
+	_, err = db.Exec(context.Background(), `DROP INDEX test_ensure_table_partial_and_expression_index_struct_deleted_at_index`)
+	require.NoError(t, err)
+	_, err = db.Exec(context.Background(), `CREATE INDEX test_ensure_table_partial_and_expression_index_struct_deleted_at_index ON test_ensure_table_partial_and_expression_index_struct (deleted_at) WHERE deleted_at IS NOT NULL`)
+	require.NoError(t, err)
+	_, err = db.Exec(context.Background(), `DROP INDEX test_ensure_table_partial_and_expression_index_struct_email_unique`)
+	require.NoError(t, err)
+	_, err = db.Exec(context.Background(), `CREATE UNIQUE INDEX test_ensure_table_partial_and_expression_index_struct_email_unique ON test_ensure_table_partial_and_expression_index_struct (upper(email))`)
+	require.NoError(t, err)
+
+	require.NoError(t, db.ensureTable(context.Background(), r))
+
+	d, err = db.drift(context.Background(), r)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		"test_ensure_table_partial_and_expression_index_struct_deleted_at_index",
+		"test_ensure_table_partial_and_expression_index_struct_email_unique",
+	}, d.StaleIndexes)
+	require.Empty(t, d.MissingIndexes)
+}
+
+type TestEnsureTable_RenamedFrom_StructV1 struct {
+	Id    string `db:"pk"`
+	Email string `db:"unique"`
+	Name  string `db:"index(composite=[Email])"`
+}
+
+type TestEnsureTable_RenamedFrom_StructV2 struct {
+	Id           string `db:"pk"`
+	EmailAddress string `db:"renamedFrom(Email),unique"`
+	Name         string `db:"index(composite=[EmailAddress])"`
+}
+
+func TestEnsureTable_RenamedFrom(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// both versions of the struct use the same table
+	v1 := mustNewMetaStruct(&TestEnsureTable_RenamedFrom_StructV1{})
+	v1.name = "test_ensure_table_renamed_from"
+	v2 := mustNewMetaStruct(&TestEnsureTable_RenamedFrom_StructV2{})
+	v2.name = "test_ensure_table_renamed_from"
+
+	require.NoError(t, db.ensureTable(context.Background(), v1))
+	_, err = db.Exec(context.Background(), `INSERT INTO test_ensure_table_renamed_from (id, email) VALUES ('1', 'foo@example.com')`)
+	require.NoError(t, err)
+
+	// rename column and keep data
+	require.NoError(t, db.ensureTable(context.Background(), v2))
+
+	tbl, err := db.describeTable(context.Background(), "test_ensure_table_renamed_from")
+	require.NoError(t, err)
+	require.False(t, tbl.hasColumnByName("Email"))
+	require.True(t, tbl.hasColumnByName("EmailAddress"))
+
+	// indexes were renamed, not created again
+	names := make([]string, 0)
+	for _, i := range tbl.Indexes {
+		names = append(names, i.Name)
+	}
+	require.ElementsMatch(t, []string{
+		"test_ensure_table_renamed_from_pk",
+		"test_ensure_table_renamed_from_email_address_unique",
+		"test_ensure_table_renamed_from_name_email_address_index",
+	}, names)
+
+	var email string
+	require.NoError(t, db.QueryRow(context.Background(), `SELECT email_address FROM test_ensure_table_renamed_from WHERE id = '1'`).Scan(&email))
+	require.Equal(t, "foo@example.com", email)
+
+	// column was already renamed
+	log := &testLogger{}
+	db.Logger = log
+	require.NoError(t, db.ensureTable(context.Background(), v2))
+	require.NotContains(t, log.writer.String(), "ALTER")
+}
+
+type TestEnsureTable_SafeTypeChange_StructV1 struct {
+	Id   string `db:"pk"`
+	Col1 int
+	Col2 string
+	Col3 string
+}
+
+type testBigint int
+
+func (testBigint) ColumnType() string {
+	return "bigint not null default 0"
+}
+
+type TestEnsureTable_SafeTypeChange_StructV2 struct {
+	Id   string `db:"pk"`
+	Col1 testBigint
+	Col2 map[string]string
+	Col3 int
+}
+
+func TestEnsureTable_SafeTypeChange(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// both versions of the struct use the same table
+	v1 := mustNewMetaStruct(&TestEnsureTable_SafeTypeChange_StructV1{})
+	v1.name = "test_ensure_table_safe_type_change"
+	v2 := mustNewMetaStruct(&TestEnsureTable_SafeTypeChange_StructV2{})
+	v2.name = "test_ensure_table_safe_type_change"
+
+	require.NoError(t, db.ensureTable(context.Background(), v1))
+	_, err = db.Exec(context.Background(), `INSERT INTO test_ensure_table_safe_type_change (id, col1, col2) VALUES ('1', 1, '{"a": "b"}'), ('2', 2, '')`)
+	require.NoError(t, err)
+
+	// widen int to bigint and text to jsonb, but not text to integer
+	require.NoError(t, db.ensureTable(context.Background(), v2))
+
+	tbl, err := db.describeTable(context.Background(), "test_ensure_table_safe_type_change")
+	require.NoError(t, err)
+
+	col1, _ := tbl.column("col1")
+	require.Equal(t, "bigint", col1.DataType)
+
+	col2, _ := tbl.column("col2")
+	require.Equal(t, "jsonb", col2.DataType)
+	require.True(t, bool(col2.IsNullable))
+
+	col3, _ := tbl.column("col3")
+	require.Equal(t, "text", col3.DataType)
+
+	// unsafe type change is reported as drift
+	d, err := db.drift(context.Background(), v2)
+	require.NoError(t, err)
+	require.Len(t, d.MismatchedColumns, 1)
+	require.Equal(t, "col3", d.MismatchedColumns[0].Column)
+
+	// columns were already changed
+	log := &testLogger{}
+	db.Logger = log
+	require.NoError(t, db.ensureTable(context.Background(), v2))
+	require.NotContains(t, log.writer.String(), "ALTER")
+}
+
+func TestEnsureTable_SafeTypeChange_InvalidJSON(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	v1 := mustNewMetaStruct(&TestEnsureTable_SafeTypeChange_StructV1{})
+	v1.name = "test_ensure_table_safe_type_change_invalid_json"
+	v2 := mustNewMetaStruct(&TestEnsureTable_SafeTypeChange_StructV2{})
+	v2.name = "test_ensure_table_safe_type_change_invalid_json"
+
+	require.NoError(t, db.ensureTable(context.Background(), v1))
+	_, err = db.Exec(context.Background(), `INSERT INTO test_ensure_table_safe_type_change_invalid_json (id, col2) VALUES ('1', '{"a": "b"}'), ('2', 'not json')`)
+	require.NoError(t, err)
+
+	// text to jsonb is skipped, other columns are still widened
+	require.NoError(t, db.ensureTable(context.Background(), v2))
+
+	tbl, err := db.describeTable(context.Background(), "test_ensure_table_safe_type_change_invalid_json")
+	require.NoError(t, err)
+
+	col1, _ := tbl.column("col1")
+	require.Equal(t, "bigint", col1.DataType)
+
+	col2, _ := tbl.column("col2")
+	require.Equal(t, "text", col2.DataType)
+
+	// skipped type change is reported as drift
+	d, err := db.drift(context.Background(), v2)
+	require.NoError(t, err)
+	require.Len(t, d.MismatchedColumns, 2)
+	require.Equal(t, "col2", d.MismatchedColumns[0].Column)
+}
+
 type TestEnsureTable_ForeignKey_StructA struct {
 	Col1 string `db:"pk"`
 	Col2 string `db:"references(struct=TestEnsureTable_ForeignKey_StructB field=Col2)"`
@@ -1148,15 +1660,15 @@ func TestEnsureTable_ForeignKey(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_ForeignKey_StructA{})))
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_ForeignKey_StructB{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_ForeignKey_StructA{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_ForeignKey_StructB{})))
 
-	require.NoError(t, db.ensureForeignKeys(mustNewMetaStruct(&TestEnsureTable_ForeignKey_StructA{})))
-	require.NoError(t, db.ensureForeignKeys(mustNewMetaStruct(&TestEnsureTable_ForeignKey_StructB{})))
+	require.NoError(t, db.ensureForeignKeys(context.Background(), mustNewMetaStruct(&TestEnsureTable_ForeignKey_StructA{})))
+	require.NoError(t, db.ensureForeignKeys(context.Background(), mustNewMetaStruct(&TestEnsureTable_ForeignKey_StructB{})))
 
 	// foreign key already exists
-	require.NoError(t, db.ensureForeignKeys(mustNewMetaStruct(&TestEnsureTable_ForeignKey_StructA{})))
-	require.NoError(t, db.ensureForeignKeys(mustNewMetaStruct(&TestEnsureTable_ForeignKey_StructB{})))
+	require.NoError(t, db.ensureForeignKeys(context.Background(), mustNewMetaStruct(&TestEnsureTable_ForeignKey_StructA{})))
+	require.NoError(t, db.ensureForeignKeys(context.Background(), mustNewMetaStruct(&TestEnsureTable_ForeignKey_StructB{})))
 
 	log.Equal(t, "test_data/test_ensure_table_foreign_key.txt")
 }
@@ -1175,11 +1687,95 @@ func TestEnsureTable_PartitionByRange(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestEnsureTable_PartitionByRange_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestEnsureTable_PartitionByRange_Struct{})))
 
 	log.Equal(t, "test_data/test_ensure_table_partition_by_range.txt")
 }
 
+type TestEnsureTable_Check_Struct struct {
+	Col1 string `db:"pk"`
+	Col2 int
+}
+
+type TestEnsureTable_Check_StructV2 struct {
+	Col1 string `db:"pk"`
+	Col2 int    `db:"check(expr='col2 >= 0')"`
+}
+
+func TestEnsureTable_Check(t *testing.T) {
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	r := mustNewMetaStruct(&TestEnsureTable_Check_Struct{})
+	require.NoError(t, db.ensureTable(context.Background(), r))
+
+	_, err = db.Exec(context.Background(), `INSERT INTO test_ensure_table_check_struct (col1, col2) VALUES ('a', -1)`)
+	require.NoError(t, err)
+
+	// existing rows violate the check, which is added but not validated
+	v2 := mustNewMetaStruct(&TestEnsureTable_Check_StructV2{})
+	v2.name = r.name
+	require.NoError(t, db.ensureTable(context.Background(), v2))
+	require.NoError(t, db.validateChecks(context.Background(), v2))
+
+	checks, err := db.describeChecks(context.Background(), "test_ensure_table_check_struct")
+	require.NoError(t, err)
+	require.Equal(t, map[string]check{"test_ensure_table_check_struct_col2_check": {Definition: "CHECK ((col2 >= 0)) NOT VALID", Validated: false}}, checks)
+
+	d, err := db.drift(context.Background(), v2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"test_ensure_table_check_struct_col2_check"}, d.UnvalidatedChecks)
+
+	// new rows are checked already
+	_, err = db.Exec(context.Background(), `INSERT INTO test_ensure_table_check_struct (col1, col2) VALUES ('b', -1)`)
+	require.Error(t, err)
+
+	// fix existing rows and validate
+	_, err = db.Exec(context.Background(), `UPDATE test_ensure_table_check_struct SET col2 = 0`)
+	require.NoError(t, err)
+	require.NoError(t, db.ensureTable(context.Background(), v2))
+	require.NoError(t, db.validateChecks(context.Background(), v2))
+
+	checks, err = db.describeChecks(context.Background(), "test_ensure_table_check_struct")
+	require.NoError(t, err)
+	require.Equal(t, map[string]check{"test_ensure_table_check_struct_col2_check": {Definition: "CHECK ((col2 >= 0))", Validated: true}}, checks)
+
+	d, err = db.drift(context.Background(), v2)
+	require.NoError(t, err)
+	require.False(t, d.hasDrift())
+
+	// checks are validated already
+	log := &testLogger{debug: false}
+	db.Logger = log
+	require.NoError(t, db.ensureTable(context.Background(), v2))
+	require.NoError(t, db.validateChecks(context.Background(), v2))
+	require.NotContains(t, log.writer.String(), "ALTER TABLE")
+
+	// changed expressions are not migrated, but reported by Drift
+	_, err = db.Exec(context.Background(), `ALTER TABLE test_ensure_table_check_struct DROP CONSTRAINT test_ensure_table_check_struct_col2_check`)
+	require.NoError(t, err)
+	_, err = db.Exec(context.Background(), `ALTER TABLE test_ensure_table_check_struct ADD CONSTRAINT test_ensure_table_check_struct_col2_check CHECK (col2 > -10) NOT VALID`)
+	require.NoError(t, err)
+
+	log = &testLogger{debug: false}
+	db.Logger = log
+	require.NoError(t, db.ensureTable(context.Background(), v2))
+	require.NotContains(t, log.writer.String(), "ALTER TABLE")
+
+	// they are validated nonetheless
+	require.NoError(t, db.validateChecks(context.Background(), v2))
+	require.Contains(t, log.writer.String(), "VALIDATE CONSTRAINT")
+
+	checks, err = db.describeChecks(context.Background(), "test_ensure_table_check_struct")
+	require.NoError(t, err)
+	require.True(t, checks["test_ensure_table_check_struct_col2_check"].Validated)
+
+	d, err = db.drift(context.Background(), v2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"test_ensure_table_check_struct_col2_check"}, d.MismatchedChecks)
+	require.Empty(t, d.UnvalidatedChecks)
+}
+
 type TestRegisterAndMigrate_Struct struct {
 	Col1 string `db:"pk"`
 	Col2 string
@@ -1198,6 +1794,45 @@ func TestRegisterAndMigrate(t *testing.T) {
 	require.NoError(t, db.Migrate(context.Background()))
 }
 
+type TestMigrateStructs_Struct struct {
+	Col1 string `db:"pk"`
+}
+
+func TestMigrateStructs(t *testing.T) {
+	Register(&TestMigrateStructs_Struct{}, "")
+
+	db, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	log := &testLogger{}
+	db.Logger = log
+
+	require.NoError(t, db.MigrateStructs(context.Background(), &TestMigrateStructs_Struct{}))
+	require.Contains(t, log.writer.String(), "test_migrate_structs_struct")
+	require.NotContains(t, log.writer.String(), "test_register_and_migrate")
+
+	// versioned migrations are only applied by Migrate
+	require.NotContains(t, log.writer.String(), MigrationsTable)
+
+	// unregistered structs can't be migrated
+	require.Error(t, db.MigrateStructs(context.Background(), &TestEnsureDropped_Struct{}))
+}
+
+func TestIsMinServerVersion(t *testing.T) {
+	// before Postgres 10
+	require.True(t, isMinServerVersion(90605, 9))
+	require.False(t, isMinServerVersion(90605, 10))
+	require.False(t, isMinServerVersion(90605, 11))
+
+	// since Postgres 10
+	require.True(t, isMinServerVersion(100000, 10))
+	require.False(t, isMinServerVersion(100023, 11))
+	require.True(t, isMinServerVersion(110005, 11))
+	require.True(t, isMinServerVersion(140002, 11))
+	require.True(t, isMinServerVersion(140002, 14))
+	require.False(t, isMinServerVersion(130010, 14))
+}
+
 func TestAdvisoryLocks(t *testing.T) {
 	db1, err := Open(postgresURI)
 	require.NoError(t, err)
@@ -1211,25 +1846,78 @@ func TestAdvisoryLocks(t *testing.T) {
 	key := MigrateKey - 2 // random key
 
 	// db1 alone is doing some locking and unlocking
-	require.NoError(t, db1.advisoryLock(key))
-	require.NoError(t, db1.advisoryLock(key))
+	require.NoError(t, db1.advisoryLock(context.Background(), key))
+	require.NoError(t, db1.advisoryLock(context.Background(), key))
 	require.NoError(t, db1.advisoryUnlock(key))
 	require.NoError(t, db1.advisoryUnlock(key))
 	require.Equal(t, ErrNotUnlocked, db1.advisoryUnlock(key))
 
 	// db1 and db2 fighting over lock
-	require.NoError(t, db1.advisoryLock(key))
-	require.Equal(t, ErrNoLock, db2.advisoryLock(key))
+	require.NoError(t, db1.advisoryLock(context.Background(), key))
+	require.Equal(t, ErrNoLock, db2.advisoryLock(context.Background(), key))
 	require.NoError(t, db1.advisoryUnlock(key))
-	require.NoError(t, db2.advisoryLock(key))
-	require.Equal(t, ErrNoLock, db1.advisoryLock(key))
+	require.NoError(t, db2.advisoryLock(context.Background(), key))
+	require.Equal(t, ErrNoLock, db1.advisoryLock(context.Background(), key))
 	require.NoError(t, db2.advisoryUnlock(key))
 
 	// db1 dies while having a lock
-	require.NoError(t, db1.advisoryLock(key))
+	require.NoError(t, db1.advisoryLock(context.Background(), key))
 	require.NoError(t, db1.Close())
 	time.Sleep(250 * time.Millisecond) // make sure it's closed
-	require.NoError(t, db2.advisoryLock(key))
+	require.NoError(t, db2.advisoryLock(context.Background(), key))
+	require.NoError(t, db2.advisoryUnlock(key))
+}
+
+func TestWaitForAdvisoryLock(t *testing.T) {
+	db1, err := Open(postgresURI)
+	require.NoError(t, err)
+	defer db1.Close()
+
+	db2, err := Open(postgresURI)
+	require.NoError(t, err)
+	defer db2.Close()
+
+	key := MigrateKey - 3 // random key
+
+	require.NoError(t, db1.advisoryLock(context.Background(), key))
+	defer db1.advisoryUnlock(key)
+
+	// stop waiting when ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, db2.waitForAdvisoryLock(ctx, key))
+
+	// give up after max attempts
+	defer func(n int) { maxAdvisoryLockAttemtps = n }(maxAdvisoryLockAttemtps)
+	maxAdvisoryLockAttemtps = -1
+	require.Equal(t, ErrMigrateLockTimeout, db2.waitForAdvisoryLock(context.Background(), key))
+}
+
+func TestAdvisoryLocks_WithConn(t *testing.T) {
+	db1, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	db2, err := Open(postgresURI)
+	require.NoError(t, err)
+
+	// connections are closed as soon as they are returned to the pool
+	db1.SetMaxIdleConns(0)
+
+	key := MigrateKey - 3 // random key
+
+	conn, err := db1.db.Conn(context.Background())
+	require.NoError(t, err)
+	px := db1.withConn(conn)
+
+	// lock is kept across queries on the dedicated connection
+	require.NoError(t, px.advisoryLock(context.Background(), key))
+	_, err = px.version()
+	require.NoError(t, err)
+	require.Equal(t, ErrNoLock, db2.advisoryLock(context.Background(), key))
+
+	require.NoError(t, px.advisoryUnlock(key))
+	require.NoError(t, conn.Close())
+	require.NoError(t, db2.advisoryLock(context.Background(), key))
 	require.NoError(t, db2.advisoryUnlock(key))
 }
 
@@ -1297,7 +1985,7 @@ func TestDescribeTableIndexes(t *testing.T) {
 	require.NoError(t, db.advisoryUnlockAll()) // just to make sure
 	require.NoError(t, db.Migrate(context.Background()))
 
-	indexes, err := db.describeTableIndexes("test_describe_table_indexes_struct")
+	indexes, err := db.describeTableIndexes(context.Background(), "test_describe_table_indexes_struct")
 	require.NoError(t, err)
 
 	require.Len(t, indexes, 1)
@@ -1320,7 +2008,7 @@ func TestDescribeTableColumns(t *testing.T) {
 	require.NoError(t, db.advisoryUnlockAll()) // just to make sure
 	require.NoError(t, db.Migrate(context.Background()))
 
-	cols, err := db.describeTableColumns("test_describe_table_columns_struct")
+	cols, err := db.describeTableColumns(context.Background(), "test_describe_table_columns_struct")
 	require.NoError(t, err)
 
 	require.Len(t, cols, 2)
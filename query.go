@@ -19,9 +19,14 @@ var (
 type QueryStmt struct {
 	query          string
 	args           []interface{}
-	order          []string
+	order          []orderField
 	limit          int
+	hasLimit       bool
 	untrusted      bool
+	all            bool
+	paginate       bool
+	after          string
+	nextPageToken  string
 	fieldWhitelist []string
 }
 
@@ -34,6 +39,15 @@ func Query(query string, args ...interface{}) *QueryStmt {
 	}
 }
 
+// QueryAll builds a query statement that matches all records.
+// It must be used explicitly for UpdateWhere and DeleteWhere to
+// affect all records, as empty queries are refused.
+func QueryAll() *QueryStmt {
+	q := Query("")
+	q.all = true
+	return q
+}
+
 // UntrustedQuery builds a query statement that will use prepared statements.
 // The given query is verified to be valid SQL to prevent SQL injections
 // and accepts untrusted user input, i.e. from URL query parameters.
@@ -68,24 +82,27 @@ func (q *QueryStmt) Whitelist(fields ...StructFieldName) *QueryStmt {
 }
 
 // Limit sets the maximum number of returned query results.
+// Postgres.Filter uses QueryLimit if no limit is set, while
+// Postgres.FilterIter returns all results.
 func (q *QueryStmt) Limit(n int) *QueryStmt {
 	if n <= 0 {
 		return q // ignore
 	}
 
 	q.limit = n
+	q.hasLimit = true
 	return q
 }
 
 // Asc instructs the result to be ordered ascending by field.
 func (q *QueryStmt) Asc(field StructFieldName) *QueryStmt {
-	q.order = append(q.order, fmt.Sprintf("%v ASC", mustIdentifier(toString(field))))
+	q.order = append(q.order, orderField{name: toString(field)})
 	return q
 }
 
 // Desc instructs the result to be ordered descending by field.
 func (q *QueryStmt) Desc(field StructFieldName) *QueryStmt {
-	q.order = append(q.order, fmt.Sprintf("%v DESC", mustIdentifier(toString(field))))
+	q.order = append(q.order, orderField{name: toString(field), desc: true})
 	return q
 }
 
@@ -98,11 +115,32 @@ func (q *QueryStmt) queryStr() string {
 }
 
 func (q *QueryStmt) orderStr() string {
-	if len(q.order) == 0 {
+	return orderStr(q.order)
+}
+
+func orderStr(order []orderField) string {
+	if len(order) == 0 {
 		return ""
 	}
 
-	return "ORDER BY " + strings.Join(q.order, ", ")
+	out := make([]string, 0, len(order))
+	for _, o := range order {
+		out = append(out, o.String())
+	}
+
+	return "ORDER BY " + strings.Join(out, ", ")
+}
+
+type orderField struct {
+	name string
+	desc bool
+}
+
+func (o orderField) String() string {
+	if o.desc {
+		return fmt.Sprintf("%v DESC", mustIdentifier(o.name))
+	}
+	return fmt.Sprintf("%v ASC", mustIdentifier(o.name))
 }
 
 func (q *QueryStmt) validate(r *metaStruct) error {
@@ -114,6 +152,10 @@ func (q *QueryStmt) validate(r *metaStruct) error {
 }
 
 func (q *QueryStmt) validateTrusted(r *metaStruct) error {
+	if q.all && q.query == "" && len(q.args) == 0 {
+		return nil
+	}
+
 	if q.query == "" {
 		return fmt.Errorf("empty query")
 	}
@@ -29,6 +29,7 @@ func TestValidate(t *testing.T) {
 	assert.NoError(t, Query("Foo = $1 and Bar = $2", 1, 2).validate(f))
 	assert.Error(t, Query("").validate(f))
 	assert.Error(t, Query("Foo = $1", 1, 2).validate(f))
+	assert.NoError(t, QueryAll().validate(f))
 
 	assert.Error(t, UntrustedQuery("Foo = $1 and Bar = $2", 1, 2).Whitelist("Foo").validate(f))
 	assert.NoError(t, UntrustedQuery("Foo = $1 and Bar = $2", 1, 2).Whitelist("Foo", "Bar").validate(f))
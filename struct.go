@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -60,6 +61,98 @@ func RegisterWithPrefix(s Struct, alias string, prefixID string) {
 	structs[globalStructsName(s)] = x
 }
 
+// registeredStructs returns all registered structs sorted by name
+func registeredStructs() []*metaStruct {
+	structsMu.RLock()
+	defer structsMu.RUnlock()
+
+	out := make([]*metaStruct, 0, len(structs))
+	for _, x := range structs {
+		out = append(out, x)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].name < out[j].name
+	})
+	return out
+}
+
+// registeredStruct returns the registered struct for s
+func registeredStruct(s Struct) (*metaStruct, bool) {
+	structsMu.RLock()
+	defer structsMu.RUnlock()
+
+	x, ok := structs[globalStructsName(s)]
+	return x, ok
+}
+
+// resolveStructs returns the registered structs for s, including all
+// structs they reference with foreign keys. Referenced structs come first.
+func resolveStructs(s ...Struct) ([]*metaStruct, error) {
+	structsMu.RLock()
+	defer structsMu.RUnlock()
+
+	out := make([]*metaStruct, 0, len(s))
+	seen := make(map[*metaStruct]bool)
+
+	var visit func(x *metaStruct) error
+	visit = func(x *metaStruct) error {
+		if seen[x] {
+			return nil // already added or a circular reference
+		}
+		seen[x] = true
+
+		for _, f := range x.fields {
+			for _, fk := range f.foreignKeys {
+				ref, ok := lookupStruct(fk.structName)
+				if !ok {
+					return fmt.Errorf("struct %v references unregistered struct %v", x.name, fk.structName)
+				}
+
+				if err := visit(ref); err != nil {
+					return err
+				}
+			}
+		}
+
+		out = append(out, x)
+		return nil
+	}
+
+	for _, v := range s {
+		if v == nil {
+			return nil, fmt.Errorf("struct is nil")
+		}
+
+		x, ok := structs[globalStructsName(v)]
+		if !ok {
+			return nil, fmt.Errorf("struct %T is not registered", v)
+		}
+
+		if err := visit(x); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// lookupStruct returns the registered struct by its Go type name or alias.
+// The caller must hold structsMu.
+func lookupStruct(name string) (*metaStruct, bool) {
+	if x, ok := structs[globalStructsNameFromString(name)]; ok {
+		return x, true
+	}
+
+	for _, x := range structs {
+		if strings.EqualFold(x.name, toSnake(name)) {
+			return x, true
+		}
+	}
+
+	return nil, false
+}
+
 // StructFieldName defines a struct's field name where interface{} must be
 // "resolvable" as string.
 type StructFieldName interface{}
@@ -89,7 +182,11 @@ type field struct {
 	primaryKey       *primaryKeyStructTag
 	foreignKeys      []foreignKeyStructTag
 	indexes          []indexStructTag
+	checks           []checkStructTag
 	partitionByRange *partitionByRangeStructTag
+	partitionByList  *partitionByListStructTag
+	partitionByHash  *partitionByHashStructTag
+	renamedFrom      *renamedFromStructTag
 }
 
 func newMetaStruct(v interface{}) (*metaStruct, error) {
@@ -102,6 +199,14 @@ func newMetaStruct(v interface{}) (*metaStruct, error) {
 	}
 	r.fields = f
 
+	if err := r.fields.checkPartitions(); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.fields.checks(); err != nil {
+		return nil, err
+	}
+
 	return r, nil
 }
 
@@ -143,6 +248,68 @@ func (m *metaStruct) alias() string {
 	return m.name
 }
 
+// foreignKeyNames returns the names of all foreign key constraints
+// that ensureForeignKeys creates for this struct.
+func (m *metaStruct) foreignKeyNames() []string {
+	out := make([]string, 0)
+	for _, f := range m.fields {
+		if len(f.foreignKeys) > 0 {
+			out = append(out, toSnake(m.name, f.name, "fk"))
+		}
+	}
+	return out
+}
+
+// constraintFields returns the field names of a primary key, unique index,
+// foreign key or check by the name that ensureTable or ensureForeignKeys gave it.
+func (m *metaStruct) constraintFields(name string) []string {
+	if name == "" {
+		return nil
+	}
+
+	if name == toSnake(m.alias(), "pk") {
+		return m.fields.primaryNames()
+	}
+
+	for indexName, fieldNames := range m.fields.uniqueIndexes() {
+		if name == toSnake(m.alias(), indexName) {
+			return fieldNames
+		}
+	}
+
+	for _, f := range m.fields {
+		for _, fk := range f.foreignKeys {
+			if name == toSnake(m.alias(), f.name, "fk") {
+				return fk.columns(f.name)
+			}
+		}
+	}
+
+	for _, f := range m.fields {
+		for _, c := range f.checks {
+			if name == toSnake(m.alias(), c.checkName(f.name)) {
+				return []string{f.name}
+			}
+		}
+	}
+
+	// unique indexes for foreign keys are created on the referenced struct
+	structsMu.RLock()
+	defer structsMu.RUnlock()
+
+	for _, x := range structs {
+		for _, f := range x.fields {
+			for _, fk := range f.foreignKeys {
+				if name == toSnake(fk.structName, join(fk.fieldNames), "unique") {
+					return fk.fieldNames
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 // fieldMask returns fields based on given fieldmask
 func (f fields) fieldMask(fieldMask []StructFieldName) []*field {
 	out := make([]*field, 0, len(f))
@@ -275,12 +442,7 @@ func (f fields) uniqueIndexes() map[string][]string {
 				continue
 			}
 
-			// dynamically create index name if not set
-			if index.name == "" {
-				index.name = fmt.Sprintf("%v_unique", strings.Join(append([]string{x.name}, index.composite...), "_"))
-			}
-
-			out[index.name] = append([]string{x.name}, index.composite...)
+			out[index.indexName(x.name)] = append([]string{x.name}, index.composite...)
 		}
 	}
 
@@ -297,9 +459,7 @@ func (f fields) indexes() map[string][]string {
 			}
 
 			// dynamically create index name if not set
-			if index.name == "" {
-				index.name = fmt.Sprintf("%v_index", strings.Join(append([]string{x.name}, index.composite...), "_"))
-			}
+			index.name = index.indexName(x.name)
 
 			if _, ok := out[index.name]; !ok {
 				out[index.name] = []string{x.name}
@@ -315,6 +475,63 @@ func (f fields) indexes() map[string][]string {
 	return out
 }
 
+// renamedIndexNames returns the new index names by old index name,
+// for all indexes whose name changes when field from is renamed to field to.
+func (f fields) renamedIndexNames(from, to string) map[string]string {
+	rename := func(name string) string {
+		if toSnake(name) == toSnake(to) {
+			return from
+		}
+		return name
+	}
+
+	out := make(map[string]string)
+	for _, x := range f {
+		for _, index := range x.indexes {
+			old := index
+			old.composite = make([]string, 0, len(index.composite))
+			for _, name := range index.composite {
+				old.composite = append(old.composite, rename(name))
+			}
+
+			oldName, newName := old.indexName(rename(x.name)), index.indexName(x.name)
+			if toSnake(oldName) != toSnake(newName) {
+				out[oldName] = newName
+			}
+		}
+	}
+	return out
+}
+
+// indexTag returns the merged struct tag options of the (unique) index with the given name
+func (f fields) indexTag(name string, unique bool) indexStructTag {
+	out := indexStructTag{name: name, unique: unique}
+	for _, x := range f {
+		for _, index := range x.indexes {
+			if index.unique != unique || index.indexName(x.name) != name {
+				continue
+			}
+
+			if index.method != "" {
+				out.method = index.method
+			}
+
+			if index.order != "" {
+				out.order = index.order
+			}
+
+			if index.where != "" {
+				out.where = index.where
+			}
+
+			if index.expr != "" {
+				out.expr = index.expr
+			}
+		}
+	}
+	return out
+}
+
 // Scan implements database/sql#Scanner on all fields
 func (f fields) Scan(row rowScan) error {
 	values, err := scan(row, len(f))
@@ -337,12 +554,49 @@ func (f fields) Scan(row rowScan) error {
 }
 
 func (f fields) hasPartitionedField() bool {
+	strategy, _ := f.partitionBy()
+	return strategy != ""
+}
+
+// checks returns all check constraints sorted by name,
+// with names created from field names if not set.
+func (f fields) checks() ([]checkStructTag, error) {
+	out := make([]checkStructTag, 0)
+	seen := make(map[string]bool)
 	for _, x := range f {
-		if x.partitionByRange != nil {
-			return true
+		for _, c := range x.checks {
+			name := c.checkName(x.name)
+			if seen[toSnake(name)] {
+				return nil, fmt.Errorf("check %v is declared twice", name)
+			}
+			seen[toSnake(name)] = true
+			out = append(out, checkStructTag{name: name, expr: c.expr})
 		}
 	}
-	return false
+
+	sort.Slice(out, func(i, j int) bool {
+		return toSnake(out[i].name) < toSnake(out[j].name)
+	})
+	return out, nil
+}
+
+// partitionBy returns the partition strategy (RANGE, LIST or HASH)
+// and the names of the fields the table is partitioned by.
+func (f fields) partitionBy() (strategy string, fieldNames []string) {
+	for _, x := range f {
+		switch {
+		case x.partitionByRange != nil:
+			strategy = "RANGE"
+		case x.partitionByList != nil:
+			strategy = "LIST"
+		case x.partitionByHash != nil:
+			strategy = "HASH"
+		default:
+			continue
+		}
+		fieldNames = append(fieldNames, x.name)
+	}
+	return strategy, fieldNames
 }
 
 func (f fields) findByName(name string) *field {
@@ -359,6 +613,16 @@ func (f fields) findByName(name string) *field {
 	return nil
 }
 
+// hasColumnName returns true if a field maps to the given column name
+func (f fields) hasColumnName(name string) bool {
+	for i := 0; i < len(f); i++ {
+		if strings.EqualFold(toSnake(f[i].name), toSnake(name)) {
+			return true
+		}
+	}
+	return false
+}
+
 func (f fields) mustFindByName(name string) *field {
 	x := f.findByName(name)
 	if x == nil {
@@ -43,6 +43,68 @@ func Test_UniqueIndexes(t *testing.T) {
 	require.Equal(t, expect, out)
 }
 
+type TestResolveStructs_StructA struct {
+	Id string `db:"pk"`
+	B  string `db:"references(struct=TestResolveStructs_StructB, field=Id)"`
+	C  string `db:"references(struct=TestResolveStructs_StructC, field=Id)"`
+}
+
+type TestResolveStructs_StructB struct {
+	Id string `db:"pk"`
+	C  string `db:"references(struct=TestResolveStructs_StructC, field=Id)"`
+}
+
+type TestResolveStructs_StructC struct {
+	Id     string `db:"pk"`
+	Parent string `db:"references(struct=TestResolveStructs_StructC, field=Id)"`
+}
+
+type TestResolveStructs_Unregistered struct{}
+
+type TestResolveStructs_StructD struct {
+	Id string `db:"pk"`
+	E  string `db:"references(struct=test_resolve_structs_alias, field=Id)"`
+}
+
+type TestResolveStructs_StructE struct {
+	Id string `db:"pk"`
+}
+
+func TestResolveStructs(t *testing.T) {
+	Register(&TestResolveStructs_StructA{}, "")
+	Register(&TestResolveStructs_StructB{}, "")
+	Register(&TestResolveStructs_StructC{}, "")
+
+	names := func(rs []*metaStruct) []string {
+		out := make([]string, 0, len(rs))
+		for _, r := range rs {
+			out = append(out, r.name)
+		}
+		return out
+	}
+
+	// referenced structs come first
+	rs, err := resolveStructs(&TestResolveStructs_StructA{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"test_resolve_structs_struct_c", "test_resolve_structs_struct_b", "test_resolve_structs_struct_a"}, names(rs))
+
+	// circular references are fine
+	rs, err = resolveStructs(&TestResolveStructs_StructC{}, &TestResolveStructs_StructC{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"test_resolve_structs_struct_c"}, names(rs))
+
+	_, err = resolveStructs(&TestResolveStructs_Unregistered{})
+	require.Error(t, err)
+
+	// structs registered with an alias are referenced by their alias
+	Register(&TestResolveStructs_StructD{}, "")
+	Register(&TestResolveStructs_StructE{}, "test_resolve_structs_alias")
+
+	rs, err = resolveStructs(&TestResolveStructs_StructD{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"test_resolve_structs_alias", "test_resolve_structs_struct_d"}, names(rs))
+}
+
 type TestFieldsExample struct {
 	Col1 string
 	Col2 string
@@ -77,3 +139,16 @@ func TestGlobalStructsName(t *testing.T) {
 	require.Equal(t, expect, globalStructsName(&TestGlobalStructsName_Struct{}))
 	require.Equal(t, expect, globalStructsNameFromString("TestGlobalStructsName_Struct"))
 }
+
+type TestFieldsRenamedIndexNames_Struct struct {
+	EmailAddress string `db:"renamedFrom(Email),unique,index(name=foo)"`
+	Name         string `db:"index(composite=[EmailAddress])"`
+}
+
+func TestFieldsRenamedIndexNames(t *testing.T) {
+	fs := mustNewFields(&TestFieldsRenamedIndexNames_Struct{}, true)
+	require.Equal(t, map[string]string{
+		"Email_unique":     "EmailAddress_unique",
+		"Name_Email_index": "Name_EmailAddress_index",
+	}, fs.renamedIndexNames("Email", "EmailAddress"))
+}
@@ -2,6 +2,10 @@ package postgres
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/alecthomas/participle"
 )
@@ -22,25 +26,46 @@ type stFunction struct {
 }
 
 type stArg struct {
-	Name  string  `@Ident`
-	Value stValue `"=" @@`
+	Name  string   `@Ident`
+	Value *stValue `("=" @@)?`
+}
+
+// hasValue returns false for bare arguments without value, i.e. `bar` in `foo(bar)`
+func (a *stArg) hasValue() bool {
+	return a.Value != nil
 }
 
 func (a *stArg) String() string {
-	if a.Value.String != nil {
+	if a.hasValue() && a.Value.String != nil {
 		return *a.Value.String
 	}
 	return ""
 }
 
+func (a *stArg) Int() (int, bool) {
+	if a.hasValue() && a.Value.Int != nil {
+		return *a.Value.Int, true
+	}
+	return 0, false
+}
+
 func (a *stArg) List() []string {
+	if !a.hasValue() {
+		return nil
+	}
 	return a.Value.List
 }
 
 func (a *stArg) GoString() string {
-	if a.Value.String != nil {
+	if !a.hasValue() {
+		return a.Name
+
+	} else if a.Value.String != nil {
 		return fmt.Sprintf("%v = %v", a.Name, *a.Value.String)
 
+	} else if a.Value.Duration != nil {
+		return fmt.Sprintf("%v = %v", a.Name, *a.Value.Duration)
+
 	} else if a.Value.Float != nil {
 		return fmt.Sprintf("%v = %f", a.Name, *a.Value.Float)
 
@@ -56,10 +81,11 @@ func (a *stArg) GoString() string {
 }
 
 type stValue struct {
-	String *string  `  (@String|@Ident)`
-	Float  *float64 `| @Float`
-	Int    *int     `| @Int`
-	List   []string `| "[" ( (@String|@Ident) ( ","? (@String|@Ident) )* )? "]"`
+	String   *string  `  (@String|@Ident)`
+	Duration *string  `| @(Int ("d"|"w"|"mo"|"y"))` // i.e. 90d, parsed by parsePartitionRetention
+	Float    *float64 `| @Float`
+	Int      *int     `| @Int`
+	List     []string `| "[" ( (@String|@Ident) ( ","? (@String|@Ident) )* )? "]"`
 }
 
 func parseStructTag(tag string) (*structTag, error) {
@@ -71,6 +97,19 @@ func parseStructTag(tag string) (*structTag, error) {
 	if err := structTagParser.ParseString(tag, st); err != nil {
 		return nil, fmt.Errorf(`StructTag "%v": %v`, tag, err)
 	}
+
+	// only renamedFrom takes a bare argument, all other arguments need a value
+	for _, function := range st.Functions {
+		if function.Name == "renamedFrom" {
+			continue
+		}
+		for _, arg := range function.Args {
+			if !arg.hasValue() {
+				return nil, fmt.Errorf(`StructTag "%v": %v: %v requires a value`, tag, function.Name, arg.Name)
+			}
+		}
+	}
+
 	return st, nil
 }
 
@@ -79,9 +118,37 @@ type indexStructTag struct {
 	unique    bool
 	method    string
 	order     string
+	where     string   // where is the predicate of a partial index
+	expr      string   // expr replaces the columns of an expression index
 	composite []string // composite is guaranteed to not include parent name
 }
 
+// indexName returns the name of the index, which is created
+// dynamically from the field names if not set.
+func (i indexStructTag) indexName(fieldName string) string {
+	if i.name != "" {
+		return i.name
+	}
+
+	suffix := "index"
+	if i.unique {
+		suffix = "unique"
+	}
+
+	return fmt.Sprintf("%v_%v", strings.Join(append([]string{fieldName}, i.composite...), "_"), suffix)
+}
+
+// indexMethods are the index methods supported by Postgres
+var indexMethods = []string{"btree", "hash", "gist", "spgist", "gin", "brin"}
+
+func isIndexMethod(method string) bool {
+	return stringSliceContains(indexMethods, method)
+}
+
+func isIndexOrder(order string) bool {
+	return strings.EqualFold(order, "asc") || strings.EqualFold(order, "desc")
+}
+
 type primaryKeyStructTag struct {
 	name      string
 	method    string
@@ -90,11 +157,139 @@ type primaryKeyStructTag struct {
 }
 
 type foreignKeyStructTag struct {
-	structName string
-	fieldNames []string
+	structName        string
+	fieldNames        []string
+	composite         []string // composite is guaranteed to not include parent name
+	onDelete          string   // onDelete is one of foreignKeyActions, defaults to cascade
+	deferrable        bool
+	initiallyDeferred bool
+}
+
+// columns returns the local field names of the foreign key
+func (fk foreignKeyStructTag) columns(fieldName string) []string {
+	return append([]string{fieldName}, fk.composite...)
+}
+
+// onDeleteAction returns the ON DELETE action of the foreign key
+func (fk foreignKeyStructTag) onDeleteAction() string {
+	if fk.onDelete == "" {
+		return "CASCADE"
+	}
+	return strings.ToUpper(fk.onDelete)
 }
 
-type partitionByRangeStructTag struct{}
+// equal returns true if the foreign key x, as described by describeForeignKeys,
+// has the columns, onDelete action and deferrability of the struct tag.
+func (fk foreignKeyStructTag) equal(fieldName string, x foreignKey) bool {
+	columns := fk.columns(fieldName)
+	if len(columns) != len(x.Columns) {
+		return false
+	}
+	for i := 0; i < len(columns); i++ {
+		if toSnake(columns[i]) != x.Columns[i] {
+			return false
+		}
+	}
+
+	return fk.onDeleteAction() == x.OnDelete &&
+		fk.deferrable == x.Deferrable &&
+		fk.initiallyDeferred == x.InitiallyDeferred
+}
+
+// foreignKeyActions are the referential actions supported by Postgres
+var foreignKeyActions = []string{"cascade", "restrict", "no action", "set null", "set default"}
+
+// parseForeignKeyAction accepts actions like `set null` or `set_null`
+func parseForeignKeyAction(in string) (string, bool) {
+	action := strings.ToLower(strings.Join(strings.Fields(strings.Replace(in, "_", " ", -1)), " "))
+	return action, stringSliceContains(foreignKeyActions, action)
+}
+
+type checkStructTag struct {
+	name string
+	expr string // expr is the raw SQL boolean expression of the constraint
+}
+
+// checkName returns the name of the check constraint,
+// which is created from the field name if not set.
+func (c checkStructTag) checkName(fieldName string) string {
+	if c.name != "" {
+		return c.name
+	}
+	return fmt.Sprintf("%v_check", fieldName)
+}
+
+type partitionByRangeStructTag struct {
+	interval  string             // interval of automatically created partitions, see MaintainPartitions
+	premake   int                // premake is the number of partitions created ahead of the current one
+	retention partitionRetention // retention is the age after which partitions are dropped
+	noDefault bool               // noDefault disables the default partition
+}
+
+type partitionByListStructTag struct {
+	values []string // values get a partition each, other values go to the default partition
+}
+
+type partitionByHashStructTag struct {
+	modulus int // modulus is the number of partitions
+}
+
+// partitionRetention is a duration like `90d` in days, weeks, months or years
+type partitionRetention struct {
+	n    int
+	unit string
+}
+
+func (r partitionRetention) isZero() bool {
+	return r.n == 0
+}
+
+// before returns t minus the retention
+func (r partitionRetention) before(t time.Time) time.Time {
+	switch r.unit {
+	case "d":
+		return t.AddDate(0, 0, -r.n)
+	case "w":
+		return t.AddDate(0, 0, -7*r.n)
+	case "mo":
+		return t.AddDate(0, -r.n, 0)
+	case "y":
+		return t.AddDate(-r.n, 0, 0)
+	default:
+		panic(fmt.Sprintf("unknown retention unit %v", r.unit))
+	}
+}
+
+func (r partitionRetention) String() string {
+	return fmt.Sprintf("%v%v", r.n, r.unit)
+}
+
+var partitionRetentionRegexp = regexp.MustCompile(`^([0-9]+)(d|w|mo|y)$`)
+
+func parsePartitionRetention(in string) (partitionRetention, error) {
+	m := partitionRetentionRegexp.FindStringSubmatch(in)
+	if m == nil {
+		return partitionRetention{}, fmt.Errorf("invalid retention %v, expected i.e. 90d, 12w, 6mo or 1y", in)
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n <= 0 {
+		return partitionRetention{}, fmt.Errorf("invalid retention %v, must be greater than zero", in)
+	}
+
+	return partitionRetention{n: n, unit: m[2]}, nil
+}
+
+// partitionIntervals are the intervals supported by MaintainPartitions
+var partitionIntervals = []string{"day", "week", "month", "year"}
+
+// defaultPartitionPremake is the number of upcoming partitions
+// created by MaintainPartitions if premake is not set
+const defaultPartitionPremake = 3
+
+type renamedFromStructTag struct {
+	name string // name is the old field or column name
+}
 
 func (f *field) parseStructTag(tag string) error {
 	s, err := parseStructTag(tag)
@@ -111,12 +306,28 @@ func (f *field) parseStructTag(tag string) error {
 				switch arg.Name {
 				case "method":
 					pkSt.method = arg.String()
+					if !isIndexMethod(pkSt.method) {
+						return fmt.Errorf("pk: unknown method %v", pkSt.method)
+					}
+
+					// primary keys are always backed by an unique btree index
+					if indexMethod(pkSt.method) != "btree" {
+						return fmt.Errorf("pk: method must be btree")
+					}
 
 				case "name":
 					pkSt.name = arg.String()
 
 				case "order":
 					pkSt.order = arg.String()
+					if !isIndexOrder(pkSt.order) {
+						return fmt.Errorf("pk: unknown order %v", pkSt.order)
+					}
+
+					// primary keys are always in ascending order
+					if isDescOrder(pkSt.order) {
+						return fmt.Errorf("pk: order must be asc")
+					}
 
 				case "composite":
 					pkSt.composite = arg.List()
@@ -143,12 +354,29 @@ func (f *field) parseStructTag(tag string) error {
 
 				case "method":
 					indexSt.method = arg.String()
+					if !isIndexMethod(indexSt.method) {
+						return fmt.Errorf("%v: unknown method %v", function.Name, indexSt.method)
+					}
+
+					// Postgres only supports unique btree indexes
+					if indexSt.unique && indexMethod(indexSt.method) != "btree" {
+						return fmt.Errorf("unique: method must be btree")
+					}
 
 				case "name":
 					indexSt.name = arg.String()
 
 				case "order":
 					indexSt.order = arg.String()
+					if !isIndexOrder(indexSt.order) {
+						return fmt.Errorf("%v: unknown order %v", function.Name, indexSt.order)
+					}
+
+				case "where":
+					indexSt.where = arg.String()
+
+				case "expr":
+					indexSt.expr = arg.String()
 
 				case "composite":
 					indexSt.composite = arg.List()
@@ -162,6 +390,11 @@ func (f *field) parseStructTag(tag string) error {
 				}
 			}
 
+			// Postgres only supports ordering of btree indexes
+			if indexSt.order != "" && indexMethod(indexSt.method) != "btree" {
+				return fmt.Errorf("%v: order requires method btree", function.Name)
+			}
+
 			// make sure composite does not contain name
 			indexSt.composite = removeFromStringSlice(indexSt.composite, f.name)
 
@@ -169,6 +402,7 @@ func (f *field) parseStructTag(tag string) error {
 
 		case "references":
 			fkSt := foreignKeyStructTag{}
+			deferrableSet := false
 			for _, arg := range function.Args {
 				switch arg.Name {
 
@@ -181,14 +415,153 @@ func (f *field) parseStructTag(tag string) error {
 				case "field":
 					fkSt.fieldNames = []string{arg.String()}
 
+				case "composite":
+					fkSt.composite = arg.List()
+
+				case "onDelete":
+					action, ok := parseForeignKeyAction(arg.String())
+					if !ok {
+						return fmt.Errorf("references: unknown onDelete action %v", arg.String())
+					}
+					fkSt.onDelete = action
+
+				case "deferrable":
+					fkSt.deferrable, err = strconv.ParseBool(arg.String())
+					if err != nil {
+						return fmt.Errorf("references: deferrable must be true or false")
+					}
+					deferrableSet = true
+
+				case "initiallyDeferred":
+					fkSt.initiallyDeferred, err = strconv.ParseBool(arg.String())
+					if err != nil {
+						return fmt.Errorf("references: initiallyDeferred must be true or false")
+					}
+
 				default:
 					return fmt.Errorf("references: unknown argument %v", arg.Name)
 				}
 			}
+
+			// make sure composite does not contain name
+			fkSt.composite = removeFromStringSlice(fkSt.composite, f.name)
+
+			if len(fkSt.composite) > 0 && len(fkSt.composite)+1 != len(fkSt.fieldNames) {
+				return fmt.Errorf("references: composite and fields must have the same number of fields")
+			}
+
+			if fkSt.initiallyDeferred {
+				if deferrableSet && !fkSt.deferrable {
+					return fmt.Errorf("references: initiallyDeferred requires deferrable")
+				}
+				fkSt.deferrable = true
+			}
+
 			f.foreignKeys = append(f.foreignKeys, fkSt)
 
+		case "check":
+			checkSt := checkStructTag{}
+			for _, arg := range function.Args {
+				switch arg.Name {
+				case "name":
+					checkSt.name = arg.String()
+
+				case "expr":
+					checkSt.expr = arg.String()
+
+				default:
+					return fmt.Errorf("check: unknown argument %v", arg.Name)
+				}
+			}
+
+			if checkSt.expr == "" {
+				return fmt.Errorf("check: expr is required")
+			}
+			f.checks = append(f.checks, checkSt)
+
 		case "partitionByRange":
-			f.partitionByRange = &partitionByRangeStructTag{}
+			partitionSt := &partitionByRangeStructTag{premake: defaultPartitionPremake}
+			for _, arg := range function.Args {
+				switch arg.Name {
+				case "interval":
+					partitionSt.interval = strings.ToLower(arg.String())
+					if !stringSliceContains(partitionIntervals, partitionSt.interval) {
+						return fmt.Errorf("partitionByRange: unknown interval %v", arg.String())
+					}
+
+				case "premake":
+					premake, ok := arg.Int()
+					if !ok || premake < 0 {
+						return fmt.Errorf("partitionByRange: premake must be zero or greater")
+					}
+					partitionSt.premake = premake
+
+				case "retention":
+					retention := arg.String()
+					if arg.Value.Duration != nil {
+						retention = *arg.Value.Duration
+					}
+					partitionSt.retention, err = parsePartitionRetention(retention)
+					if err != nil {
+						return fmt.Errorf("partitionByRange: %v", err)
+					}
+
+				case "default":
+					withDefault, err := strconv.ParseBool(arg.String())
+					if err != nil {
+						return fmt.Errorf("partitionByRange: default must be true or false")
+					}
+					partitionSt.noDefault = !withDefault
+
+				default:
+					return fmt.Errorf("partitionByRange: unknown argument %v", arg.Name)
+				}
+			}
+
+			if partitionSt.interval == "" && (!partitionSt.retention.isZero() || partitionSt.noDefault) {
+				return fmt.Errorf("partitionByRange: retention and default require interval")
+			}
+			f.partitionByRange = partitionSt
+
+		case "partitionByList":
+			partitionSt := &partitionByListStructTag{}
+			for _, arg := range function.Args {
+				switch arg.Name {
+				case "values":
+					partitionSt.values = arg.List()
+
+				default:
+					return fmt.Errorf("partitionByList: unknown argument %v", arg.Name)
+				}
+			}
+			f.partitionByList = partitionSt
+
+		case "partitionByHash":
+			partitionSt := &partitionByHashStructTag{}
+			for _, arg := range function.Args {
+				switch arg.Name {
+				case "modulus":
+					modulus, ok := arg.Int()
+					if !ok || modulus <= 0 {
+						return fmt.Errorf("partitionByHash: modulus must be greater than zero")
+					}
+					partitionSt.modulus = modulus
+
+				default:
+					return fmt.Errorf("partitionByHash: unknown argument %v", arg.Name)
+				}
+			}
+
+			if partitionSt.modulus == 0 {
+				return fmt.Errorf("partitionByHash: modulus is required")
+			}
+			f.partitionByHash = partitionSt
+
+		case "renamedFrom":
+			if len(function.Args) != 1 || function.Args[0].hasValue() {
+				return fmt.Errorf("renamedFrom: expected exactly one old name")
+			}
+			f.renamedFrom = &renamedFromStructTag{name: function.Args[0].Name}
 
 		// if unknown function name...
 		default:
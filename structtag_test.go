@@ -50,80 +50,80 @@ func TestParseStructTag(t *testing.T) {
 			"foo(abc=def)",
 			&structTag{
 				Functions: []stFunction{
-					{Name: "foo", Args: []stArg{{Name: "abc", Value: stValue{String: stringPtr("def")}}}}}},
+					{Name: "foo", Args: []stArg{{Name: "abc", Value: &stValue{String: stringPtr("def")}}}}}},
 		},
 		{
 			"foo(abc='d e f')",
 			&structTag{
 				Functions: []stFunction{
-					{Name: "foo", Args: []stArg{{Name: "abc", Value: stValue{String: stringPtr("d e f")}}}}}},
+					{Name: "foo", Args: []stArg{{Name: "abc", Value: &stValue{String: stringPtr("d e f")}}}}}},
 		},
 		{
 			// test float value
 			"foo(abc=1.0)",
 			&structTag{
 				Functions: []stFunction{
-					{Name: "foo", Args: []stArg{{Name: "abc", Value: stValue{Float: float64Ptr(1.0)}}}}}},
+					{Name: "foo", Args: []stArg{{Name: "abc", Value: &stValue{Float: float64Ptr(1.0)}}}}}},
 		},
 		{
 			// test int value
 			"foo(abc=1)",
 			&structTag{
 				Functions: []stFunction{
-					{Name: "foo", Args: []stArg{{Name: "abc", Value: stValue{Int: intPtr(1)}}}}}},
+					{Name: "foo", Args: []stArg{{Name: "abc", Value: &stValue{Int: intPtr(1)}}}}}},
 		},
 		{
 			// test empty list value
 			"foo(abc=[])",
 			&structTag{
 				Functions: []stFunction{
-					{Name: "foo", Args: []stArg{{Name: "abc", Value: stValue{}}}}}},
+					{Name: "foo", Args: []stArg{{Name: "abc", Value: &stValue{}}}}}},
 		},
 		{
 			// test list value with spacing
 			"foo(abc = [ def ])",
 			&structTag{
 				Functions: []stFunction{
-					{Name: "foo", Args: []stArg{{Name: "abc", Value: stValue{List: []string{"def"}}}}}}},
+					{Name: "foo", Args: []stArg{{Name: "abc", Value: &stValue{List: []string{"def"}}}}}}},
 		},
 		{
 			// test list value with one element
 			"foo(abc=[def])",
 			&structTag{
 				Functions: []stFunction{
-					{Name: "foo", Args: []stArg{{Name: "abc", Value: stValue{List: []string{"def"}}}}}}},
+					{Name: "foo", Args: []stArg{{Name: "abc", Value: &stValue{List: []string{"def"}}}}}}},
 		},
 		{
 			"foo(abc=['d e f'])",
 			&structTag{
 				Functions: []stFunction{
-					{Name: "foo", Args: []stArg{{Name: "abc", Value: stValue{List: []string{"d e f"}}}}}}},
+					{Name: "foo", Args: []stArg{{Name: "abc", Value: &stValue{List: []string{"d e f"}}}}}}},
 		},
 		{
 			// test list value with two elements
 			"foo(abc=[def,ghi])",
 			&structTag{
 				Functions: []stFunction{
-					{Name: "foo", Args: []stArg{{Name: "abc", Value: stValue{List: []string{"def", "ghi"}}}}}}},
+					{Name: "foo", Args: []stArg{{Name: "abc", Value: &stValue{List: []string{"def", "ghi"}}}}}}},
 		},
 		{
 			"foo(abc=[ def , ghi ])",
 			&structTag{
 				Functions: []stFunction{
-					{Name: "foo", Args: []stArg{{Name: "abc", Value: stValue{List: []string{"def", "ghi"}}}}}}},
+					{Name: "foo", Args: []stArg{{Name: "abc", Value: &stValue{List: []string{"def", "ghi"}}}}}}},
 		},
 		{
 			"foo(abc=[' d e f ', ghi ])",
 			&structTag{
 				Functions: []stFunction{
-					{Name: "foo", Args: []stArg{{Name: "abc", Value: stValue{List: []string{" d e f ", "ghi"}}}}}}},
+					{Name: "foo", Args: []stArg{{Name: "abc", Value: &stValue{List: []string{" d e f ", "ghi"}}}}}}},
 		},
 		{
 			// test list value with three elements
 			"foo(abc=[def,ghi,jkl])",
 			&structTag{
 				Functions: []stFunction{
-					{Name: "foo", Args: []stArg{{Name: "abc", Value: stValue{List: []string{"def", "ghi", "jkl"}}}}}}},
+					{Name: "foo", Args: []stArg{{Name: "abc", Value: &stValue{List: []string{"def", "ghi", "jkl"}}}}}}},
 		},
 
 		{
@@ -132,8 +132,8 @@ func TestParseStructTag(t *testing.T) {
 			&structTag{
 				Functions: []stFunction{
 					{Name: "foo", Args: []stArg{
-						{Name: "abc", Value: stValue{String: stringPtr("def")}},
-						{Name: "ghi", Value: stValue{String: stringPtr("jkl")}},
+						{Name: "abc", Value: &stValue{String: stringPtr("def")}},
+						{Name: "ghi", Value: &stValue{String: stringPtr("jkl")}},
 					}}}},
 		},
 
@@ -143,10 +143,10 @@ func TestParseStructTag(t *testing.T) {
 			&structTag{
 				Functions: []stFunction{
 					{Name: "index", Args: []stArg{
-						{Name: "method", Value: stValue{String: stringPtr("btree")}},
-						{Name: "name", Value: stValue{String: stringPtr("my_index")}},
-						{Name: "order", Value: stValue{String: stringPtr("asc")}},
-						{Name: "composite", Value: stValue{List: []string{"foo", "bar"}}},
+						{Name: "method", Value: &stValue{String: stringPtr("btree")}},
+						{Name: "name", Value: &stValue{String: stringPtr("my_index")}},
+						{Name: "order", Value: &stValue{String: stringPtr("asc")}},
+						{Name: "composite", Value: &stValue{List: []string{"foo", "bar"}}},
 					}}}},
 		},
 	}
@@ -220,6 +220,45 @@ func TestParseStructTag_Indexes(t *testing.T) {
 	require.Equal(t, expect, f.indexes)
 }
 
+func TestParseStructTag_IndexMethodAndOrder(t *testing.T) {
+	f := &field{}
+	require.NoError(t, f.parseStructTag(`index(method=gin), index(method=HASH), index(method=BTREE, order=DESC), unique(method=BTREE, order=DESC)`))
+
+	require.Error(t, f.parseStructTag(`index(method=foo)`))
+	require.Error(t, f.parseStructTag(`unique(order=up)`))
+	require.Error(t, f.parseStructTag(`unique(method=hash)`))
+	require.Error(t, f.parseStructTag(`pk(method="btree; drop table x")`))
+	require.Error(t, f.parseStructTag(`pk(order=foo)`))
+
+	// only btree indexes can be ordered
+	require.Error(t, f.parseStructTag(`index(method=hash, order=desc)`))
+	require.Error(t, f.parseStructTag(`index(order=desc, method=gin)`))
+	require.Error(t, f.parseStructTag(`index(method=brin, order=asc)`))
+
+	// primary keys are always btree in ascending order
+	require.Error(t, f.parseStructTag(`pk(method=hash)`))
+	require.Error(t, f.parseStructTag(`pk(order=desc)`))
+}
+
+func TestParseStructTag_IndexWhereAndExpr(t *testing.T) {
+	tag := `index(where='deleted_at IS NULL'), unique(expr='lower(email)')`
+
+	f := &field{}
+	require.NoError(t, f.parseStructTag(tag))
+
+	expect := []indexStructTag{
+		{
+			unique: false,
+			where:  "deleted_at IS NULL",
+		},
+		{
+			unique: true,
+			expr:   "lower(email)",
+		},
+	}
+	require.Equal(t, expect, f.indexes)
+}
+
 func TestParseStructTag_ForeignKeys(t *testing.T) {
 	tag := `references(struct=Foo, field=Bar), references(struct=a, fields=[b,c])`
 
@@ -239,10 +278,136 @@ func TestParseStructTag_ForeignKeys(t *testing.T) {
 	require.Equal(t, expect, f.foreignKeys)
 }
 
+func TestParseStructTag_ForeignKeyOptions(t *testing.T) {
+	f := field{name: "A"}
+	require.NoError(t, f.parseStructTag(`references(struct=Foo, fields=[X, Y], composite=[A, B], onDelete="set null", deferrable=true)`))
+	require.Equal(t, []foreignKeyStructTag{{
+		structName: "Foo",
+		fieldNames: []string{"X", "Y"},
+		composite:  []string{"B"},
+		onDelete:   "set null",
+		deferrable: true,
+	}}, f.foreignKeys)
+	require.Equal(t, []string{"A", "B"}, f.foreignKeys[0].columns(f.name))
+	require.Equal(t, "SET NULL", f.foreignKeys[0].onDeleteAction())
+
+	f = field{}
+	require.NoError(t, f.parseStructTag(`references(struct=Foo, field=X, onDelete=no_action, initiallyDeferred=true)`))
+	require.Equal(t, "no action", f.foreignKeys[0].onDelete)
+	require.True(t, f.foreignKeys[0].deferrable)
+	require.True(t, f.foreignKeys[0].initiallyDeferred)
+
+	f = field{}
+	require.NoError(t, f.parseStructTag(`references(struct=Foo, field=X)`))
+	require.Equal(t, "CASCADE", f.foreignKeys[0].onDeleteAction())
+
+	require.Error(t, f.parseStructTag(`references(struct=Foo, field=X, onDelete=drop)`))
+	require.Error(t, f.parseStructTag(`references(struct=Foo, field=X, deferrable=foo)`))
+	require.Error(t, f.parseStructTag(`references(struct=Foo, field=X, composite=[B])`))
+	require.Error(t, f.parseStructTag(`references(struct=Foo, field=X, deferrable=false, initiallyDeferred=true)`))
+}
+
+func TestForeignKeyStructTagEqual(t *testing.T) {
+	fk := foreignKeyStructTag{structName: "Foo", fieldNames: []string{"X", "Y"}, composite: []string{"B"}, deferrable: true}
+	x := foreignKey{Columns: []string{"a", "b"}, OnDelete: "CASCADE", Deferrable: true}
+	require.True(t, fk.equal("A", x))
+
+	require.False(t, fk.equal("A", foreignKey{Columns: []string{"b", "a"}, OnDelete: "CASCADE", Deferrable: true}))
+	require.False(t, fk.equal("A", foreignKey{Columns: []string{"a", "b"}, OnDelete: "RESTRICT", Deferrable: true}))
+	require.False(t, fk.equal("A", foreignKey{Columns: []string{"a", "b"}, OnDelete: "CASCADE"}))
+	require.False(t, fk.equal("A", foreignKey{Columns: []string{"a", "b"}, OnDelete: "CASCADE", Deferrable: true, InitiallyDeferred: true}))
+}
+
+func TestParseStructTag_RenamedFrom(t *testing.T) {
+	f := field{}
+	require.NoError(t, f.parseStructTag(`renamedFrom(OldName)`))
+	require.Equal(t, &renamedFromStructTag{name: "OldName"}, f.renamedFrom)
+
+	require.Error(t, f.parseStructTag(`renamedFrom`))
+	require.Error(t, f.parseStructTag(`renamedFrom(a, b)`))
+	require.Error(t, f.parseStructTag(`renamedFrom(name=OldName)`))
+
+	// bare arguments are only allowed for renamedFrom
+	_, err := parseStructTag(`renamedFrom(OldName)`)
+	require.NoError(t, err)
+	for _, tag := range []string{`pk(desc)`, `index(unique)`, `unique(where)`, `references(Foo)`, `check(x > 0)`, `partitionByRange(month)`, `partitionByList(a)`, `partitionByHash(modulus)`} {
+		require.Error(t, f.parseStructTag(tag), tag)
+	}
+}
+
 func TestParseStructTag_PartitionByRange(t *testing.T) {
 	tag := `partitionByRange`
 
 	f := field{}
 	require.NoError(t, f.parseStructTag(tag))
 	require.NotNil(t, f.partitionByRange)
+	require.Equal(t, "", f.partitionByRange.interval)
+}
+
+func TestParseStructTag_PartitionByRangeInterval(t *testing.T) {
+	f := field{}
+	require.NoError(t, f.parseStructTag(`partitionByRange(interval=month, premake=6)`))
+	require.Equal(t, &partitionByRangeStructTag{interval: "month", premake: 6}, f.partitionByRange)
+
+	require.NoError(t, f.parseStructTag(`partitionByRange(interval=day)`))
+	require.Equal(t, &partitionByRangeStructTag{interval: "day", premake: defaultPartitionPremake}, f.partitionByRange)
+
+	require.Error(t, f.parseStructTag(`partitionByRange(interval=hour)`))
+	require.Error(t, f.parseStructTag(`partitionByRange(interval=day, premake=-1)`))
+	require.Error(t, f.parseStructTag(`partitionByRange(interval=day, premake=foo)`))
+	require.Error(t, f.parseStructTag(`partitionByRange(foo=bar)`))
+}
+
+func TestParseStructTag_PartitionByRangeRetention(t *testing.T) {
+	f := field{}
+	require.NoError(t, f.parseStructTag(`partitionByRange(interval=month, retention=90d, default=false)`))
+	require.Equal(t, &partitionByRangeStructTag{
+		interval:  "month",
+		premake:   defaultPartitionPremake,
+		retention: partitionRetention{n: 90, unit: "d"},
+		noDefault: true,
+	}, f.partitionByRange)
+
+	require.NoError(t, f.parseStructTag(`partitionByRange(interval=day, retention="6mo")`))
+	require.Equal(t, partitionRetention{n: 6, unit: "mo"}, f.partitionByRange.retention)
+
+	require.Error(t, f.parseStructTag(`partitionByRange(retention=90d)`))
+	require.Error(t, f.parseStructTag(`partitionByRange(interval=day, retention=90)`))
+	require.Error(t, f.parseStructTag(`partitionByRange(interval=day, retention=90h)`))
+	require.Error(t, f.parseStructTag(`partitionByRange(interval=day, retention=0d)`))
+	require.Error(t, f.parseStructTag(`partitionByRange(interval=day, default=foo)`))
+}
+
+func TestParseStructTag_PartitionByList(t *testing.T) {
+	f := field{}
+	require.NoError(t, f.parseStructTag(`partitionByList(values=[acme, "ACME Corp"])`))
+	require.Equal(t, &partitionByListStructTag{values: []string{"acme", "ACME Corp"}}, f.partitionByList)
+
+	require.Error(t, f.parseStructTag(`partitionByList(foo=bar)`))
+}
+
+func TestParseStructTag_PartitionByHash(t *testing.T) {
+	f := field{}
+	require.NoError(t, f.parseStructTag(`partitionByHash(modulus=4)`))
+	require.Equal(t, &partitionByHashStructTag{modulus: 4}, f.partitionByHash)
+
+	require.Error(t, f.parseStructTag(`partitionByHash`))
+	require.Error(t, f.parseStructTag(`partitionByHash(modulus=0)`))
+	require.Error(t, f.parseStructTag(`partitionByHash(modulus=foo)`))
+	require.Error(t, f.parseStructTag(`partitionByHash(foo=bar)`))
+}
+
+func TestParseStructTag_Check(t *testing.T) {
+	f := field{}
+	require.NoError(t, f.parseStructTag(`check(expr='amount >= 0'), check(name=max_amount, expr="amount <= 100")`))
+	require.Equal(t, []checkStructTag{
+		{expr: "amount >= 0"},
+		{name: "max_amount", expr: "amount <= 100"},
+	}, f.checks)
+	require.Equal(t, "Amount_check", f.checks[0].checkName("Amount"))
+	require.Equal(t, "max_amount", f.checks[1].checkName("Amount"))
+
+	require.Error(t, f.parseStructTag(`check`))
+	require.Error(t, f.parseStructTag(`check(name=foo)`))
+	require.Error(t, f.parseStructTag(`check(foo=bar)`))
 }
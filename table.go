@@ -24,31 +24,65 @@ type index struct {
 	IsPrimary    postgresBool
 	IsFunctional postgresBool
 	IsPartial    postgresBool
+	Where        string // Where is the predicate of partial indexes
 }
 
+// hasIndex returns true if the table has an index equal to x.
 func (t *table) hasIndex(x index) bool {
 	for _, i := range t.Indexes {
-		if toSnake(i.Name) == toSnake(x.Name) &&
-			i.Type == x.Type &&
-			equalStringSlice(stringSliceToSnake(i.Columns), stringSliceToSnake(x.Columns)) &&
-			i.IsUnique == x.IsUnique &&
-			i.IsPrimary == x.IsPrimary &&
-			i.IsFunctional == x.IsFunctional &&
-			i.IsPartial == x.IsPartial {
+		if i.equal(x) {
 			return true
 		}
 	}
 	return false
 }
 
+func (t *table) hasIndexByName(name string) bool {
+	for _, i := range t.Indexes {
+		if toSnake(i.Name) == toSnake(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// renameIndex renames the index, after it was renamed in the database.
+func (t *table) renameIndex(oldName, newName string) {
+	for i := range t.Indexes {
+		if toSnake(t.Indexes[i].Name) == toSnake(oldName) {
+			t.Indexes[i].Name = newName
+		}
+	}
+}
+
+// equal returns true if both indexes are equal. Expressions and predicates
+// are compared as is, so they must be rendered by Postgres first, see renderIndexes.
+func (i index) equal(x index) bool {
+	columnsEqual := equalStringSlice(indexColumnsToSnake(i.Columns), indexColumnsToSnake(x.Columns))
+	if i.IsFunctional || x.IsFunctional {
+		columnsEqual = equalStringSlice(i.Columns, x.Columns)
+	}
+
+	return toSnake(i.Name) == toSnake(x.Name) &&
+		i.Type == x.Type &&
+		columnsEqual &&
+		i.IsUnique == x.IsUnique &&
+		i.IsPrimary == x.IsPrimary &&
+		i.IsFunctional == x.IsFunctional &&
+		i.IsPartial == x.IsPartial &&
+		i.Where == x.Where
+}
+
 func (t *table) hasUniqueIndexByColumns(columnNames []string) bool {
+	names := make([]string, len(columnNames))
 	for i := 0; i < len(columnNames); i++ {
-		columnNames[i] = toSnake(columnNames[i])
+		names[i] = toSnake(columnNames[i])
 	}
 
 	for _, i := range t.Indexes {
-		if i.IsUnique {
-			if equalStringSliceIgnoreOrder(i.Columns, columnNames) {
+		// partial and expression indexes can't back foreign keys
+		if i.IsUnique && !i.IsPartial && !i.IsFunctional {
+			if equalStringSliceIgnoreOrder(indexColumnNames(indexColumnsToSnake(i.Columns)), names) {
 				return true
 			}
 		}
@@ -57,11 +91,108 @@ func (t *table) hasUniqueIndexByColumns(columnNames []string) bool {
 }
 
 func (t *table) hasColumnByName(name string) bool {
+	_, ok := t.column(name)
+	return ok
+}
+
+func (t *table) column(name string) (column, bool) {
 	n := toSnake(name)
 	for _, c := range t.Columns {
 		if strings.EqualFold(c.Name, n) {
-			return true
+			return c, true
 		}
 	}
-	return false
+	return column{}, false
+}
+
+// newIndex returns the index, as described by describeTableIndexes,
+// that createIndex creates for the given columns and struct tag.
+func newIndex(name string, columns []string, tag indexStructTag) index {
+	if tag.expr != "" {
+		columns = []string{tag.expr}
+	} else {
+		columns = indexColumns(columns, tag.order)
+	}
+
+	return index{
+		Name:         name,
+		Type:         indexMethod(tag.method),
+		Columns:      columns,
+		IsUnique:     postgresBool(tag.unique),
+		IsFunctional: postgresBool(tag.expr != ""),
+		IsPartial:    postgresBool(tag.where != ""),
+		Where:        tag.where,
+	}
+}
+
+// indexMethod returns the index method, which defaults to btree
+func indexMethod(method string) string {
+	if method == "" {
+		return "btree"
+	}
+	return strings.ToLower(method)
+}
+
+func isDescOrder(order string) bool {
+	return strings.EqualFold(order, "desc")
+}
+
+// indexColumns returns the index columns as described by pg_get_indexdef,
+// i.e. `col DESC` for descending order.
+func indexColumns(columns []string, order string) []string {
+	out := make([]string, len(columns))
+	for i := 0; i < len(columns); i++ {
+		out[i] = columns[i]
+		if isDescOrder(order) {
+			out[i] += " DESC"
+		}
+	}
+	return out
+}
+
+// splitIndexColumn splits an index column like `col DESC` into its name and order
+func splitIndexColumn(column string) (name, order string) {
+	if strings.HasSuffix(column, " DESC") {
+		return strings.TrimSuffix(column, " DESC"), " DESC"
+	}
+	return column, ""
+}
+
+func unquoteIndexColumns(columns []string) []string {
+	out := make([]string, len(columns))
+	for i := 0; i < len(columns); i++ {
+		name, order := splitIndexColumn(columns[i])
+		out[i] = unquoteIdentifier(name) + order
+	}
+	return out
+}
+
+func indexColumnsToSnake(columns []string) []string {
+	out := make([]string, len(columns))
+	for i := 0; i < len(columns); i++ {
+		name, order := splitIndexColumn(columns[i])
+		out[i] = toSnake(name) + order
+	}
+	return out
+}
+
+// indexColumnNames returns the index columns without order
+func indexColumnNames(columns []string) []string {
+	out := make([]string, len(columns))
+	for i := 0; i < len(columns); i++ {
+		out[i], _ = splitIndexColumn(columns[i])
+	}
+	return out
+}
+
+func mustJoinIndexColumns(columns []string, order string) string {
+	out := make([]string, 0, len(columns))
+	for i := 0; i < len(columns); i++ {
+		if isDescOrder(order) {
+			out = append(out, mustIdentifier(columns[i])+" DESC")
+		} else {
+			out = append(out, mustIdentifier(columns[i]))
+		}
+	}
+	return strings.Join(out, ", ")
 }
@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableHasIndex(t *testing.T) {
+	tbl := &table{
+		Indexes: []index{
+			{Name: "foo_col1_index", Type: "hash", Columns: []string{"col1"}},
+			{Name: "foo_bar", Type: "btree", Columns: []string{"col1 DESC", "col2 DESC"}, IsUnique: true},
+		},
+	}
+
+	require.True(t, tbl.hasIndex(index{Name: "foo_col1_index", Type: indexMethod("hash"), Columns: indexColumns([]string{"Col1"}, "")}))
+	require.False(t, tbl.hasIndex(index{Name: "foo_col1_index", Type: indexMethod(""), Columns: indexColumns([]string{"Col1"}, "")}))
+
+	require.True(t, tbl.hasIndex(index{Name: "foo_bar", Type: indexMethod(""), Columns: indexColumns([]string{"Col1", "Col2"}, "desc"), IsUnique: true}))
+	require.False(t, tbl.hasIndex(index{Name: "foo_bar", Type: indexMethod(""), Columns: indexColumns([]string{"Col1", "Col2"}, "asc"), IsUnique: true}))
+
+	require.True(t, tbl.hasUniqueIndexByColumns([]string{"Col2", "Col1"}))
+}
+
+func TestTableHasIndex_PartialAndExpression(t *testing.T) {
+	tbl := &table{
+		Indexes: []index{
+			{Name: "foo_col1_index", Type: "btree", Columns: []string{"col1"}, IsPartial: true, Where: "deleted_at IS NULL"},
+			{Name: "foo_col2_unique", Type: "btree", Columns: []string{"lower(col2)"}, IsUnique: true, IsFunctional: true},
+		},
+	}
+
+	require.True(t, tbl.hasIndex(newIndex("foo_col1_index", []string{"Col1"}, indexStructTag{where: "deleted_at IS NULL"})))
+	require.False(t, tbl.hasIndex(newIndex("foo_col1_index", []string{"Col1"}, indexStructTag{where: "deleted_at IS NOT NULL"})))
+	require.False(t, tbl.hasIndex(newIndex("foo_col1_index", []string{"Col1"}, indexStructTag{})))
+
+	// expressions and predicates are compared as rendered by Postgres, see renderIndexes
+	require.True(t, tbl.hasIndex(newIndex("foo_col2_unique", []string{"Col2"}, indexStructTag{unique: true, expr: "lower(col2)"})))
+	require.False(t, tbl.hasIndex(newIndex("foo_col2_unique", []string{"Col2"}, indexStructTag{unique: true, expr: "upper(col2)"})))
+	require.False(t, tbl.hasIndex(newIndex("foo_col2_unique", []string{"Col2"}, indexStructTag{unique: true})))
+
+	require.False(t, tbl.hasUniqueIndexByColumns([]string{"Col2"}))
+}
+
+func TestUnquoteIndexColumns(t *testing.T) {
+	require.Equal(t,
+		[]string{"col1", "timestamp DESC", "col3 DESC"},
+		unquoteIndexColumns([]string{"col1", `"timestamp" DESC`, "col3 DESC"}))
+}
+
+func TestMustJoinIndexColumns(t *testing.T) {
+	require.Equal(t, `"col1", "col2"`, mustJoinIndexColumns([]string{"Col1", "Col2"}, ""))
+	require.Equal(t, `"col1" DESC, "col2" DESC`, mustJoinIndexColumns([]string{"Col1", "Col2"}, "desc"))
+}
@@ -0,0 +1 @@
+CREATE TABLE foo (id int);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS "test_dump_schema_struct_a" ( "id" text not null default '', "email" text not null default '' , CONSTRAINT "test_dump_schema_struct_a_pk" PRIMARY KEY ("id") );
+
+CREATE UNIQUE INDEX CONCURRENTLY "test_dump_schema_struct_a_email_unique" ON "test_dump_schema_struct_a" ((lower(email)));
+
+CREATE TABLE IF NOT EXISTS "test_dump_schema_struct_b" ( "id" text not null default '', "a_id" text not null default '', "created_at" timestamp (6) without time zone null , CONSTRAINT "test_dump_schema_struct_b_pk" PRIMARY KEY ("id") );
+
+CREATE INDEX CONCURRENTLY "test_dump_schema_struct_b_created_at_index" ON "test_dump_schema_struct_b" ("created_at" DESC);
+
+ALTER TABLE "test_dump_schema_struct_b" ADD CONSTRAINT "test_dump_schema_struct_b_a_id_fk" FOREIGN KEY ("a_id") REFERENCES "test_dump_schema_struct_a" ("id") MATCH SIMPLE ON DELETE CASCADE ON UPDATE CASCADE;
+
@@ -13,7 +13,13 @@ type Transaction struct {
 
 // NewTransaction starts a new transaction.
 func (p *Postgres) NewTransaction() (*Transaction, error) {
-	tx, err := p.db.BeginTx(context.Background(), nil)
+	return p.NewTransactionContext(context.Background())
+}
+
+// NewTransactionContext starts a new transaction. The transaction is rolled back
+// if ctx is cancelled before Commit is called.
+func (p *Postgres) NewTransactionContext(ctx context.Context) (*Transaction, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -27,7 +33,13 @@ func (p *Postgres) NewTransaction() (*Transaction, error) {
 // Transaction starts a new transaction and automatically commits or
 // rolls back the transaction if TransactionFunc returns an error.
 func (p *Postgres) Transaction(fn func(*Transaction) error) error {
-	tx, err := p.NewTransaction()
+	return p.TransactionContext(context.Background(), fn)
+}
+
+// TransactionContext is like Transaction, but the transaction is
+// rolled back if ctx is cancelled before it is committed.
+func (p *Postgres) TransactionContext(ctx context.Context, fn func(*Transaction) error) error {
+	tx, err := p.NewTransactionContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -58,34 +70,82 @@ func (t *Transaction) Get(ctx context.Context, s Struct) error {
 	return getStruct(t, ctx, s)
 }
 
+// GetMany finds records for all structs in a slice by their primary keys.
+// See Postgres.GetMany for more details.
+func (t *Transaction) GetMany(ctx context.Context, s StructSlice) error {
+	return getManyStruct(t, ctx, s)
+}
+
 // Filter finds records based on QueryStmt. See Postgres.Filter for more details.
 func (t *Transaction) Filter(ctx context.Context, s StructSlice, q *QueryStmt) error {
 	return filterStruct(t, ctx, s, q)
 }
 
+// FilterIter finds records based on QueryStmt and returns an Iterator.
+// See Postgres.FilterIter for more details.
+func (t *Transaction) FilterIter(ctx context.Context, s Struct, q *QueryStmt) (*Iterator, error) {
+	return filterIterStruct(t, ctx, s, q)
+}
+
+// Count returns the number of records matching QueryStmt.
+// See Postgres.Count for more details.
+func (t *Transaction) Count(ctx context.Context, s Struct, q *QueryStmt) (int64, error) {
+	return countStruct(t, ctx, s, q)
+}
+
+// Exists returns true if at least one record matches QueryStmt.
+// See Postgres.Exists for more details.
+func (t *Transaction) Exists(ctx context.Context, s Struct, q *QueryStmt) (bool, error) {
+	return existsStruct(t, ctx, s, q)
+}
+
 // Insert creates a new record. See Postgres.Insert for more details.
 func (t *Transaction) Insert(ctx context.Context, s Struct, fieldMask ...StructFieldName) error {
 	return insertStruct(t, ctx, s, fieldMask...)
 }
 
+// InsertMany creates new records for all structs in a slice at once.
+// See Postgres.InsertMany for more details.
+func (t *Transaction) InsertMany(ctx context.Context, s StructSlice, fieldMask ...StructFieldName) error {
+	return insertManyStruct(t, ctx, s, fieldMask...)
+}
+
 // Update updates an existing record by looking at the orimary keys of a struct.
 // See Postgres.Update for more details.
 func (t *Transaction) Update(ctx context.Context, s Struct, fieldMask ...StructFieldName) error {
 	return updateStruct(t, ctx, s, fieldMask...)
 }
 
+// UpdateWhere updates all records matching QueryStmt with the values of a struct.
+// See Postgres.UpdateWhere for more details.
+func (t *Transaction) UpdateWhere(ctx context.Context, s Struct, q *QueryStmt, fieldMask ...StructFieldName) (int64, error) {
+	return updateWhereStruct(t, ctx, s, q, fieldMask...)
+}
+
 // Save creates a new record or updates an existing record by looking at
 // the primary keys of a struct. See Postgres.Filter for more details.
 func (t *Transaction) Save(ctx context.Context, s Struct, fieldMask ...StructFieldName) error {
 	return saveStruct(t, ctx, s, fieldMask...)
 }
 
+// SaveMany creates new records or updates existing records for all structs
+// in a slice. See Postgres.SaveMany for more details.
+func (t *Transaction) SaveMany(ctx context.Context, s StructSlice, fieldMask ...StructFieldName) error {
+	return saveManyStruct(t, ctx, s, fieldMask...)
+}
+
 // Delete deletes a record by looking at the primary keys of a struct.
 // See Postgres.Delete for more details.
 func (t *Transaction) Delete(ctx context.Context, s Struct) error {
 	return deleteStruct(t, ctx, s)
 }
 
+// DeleteWhere deletes all records matching QueryStmt.
+// See Postgres.DeleteWhere for more details.
+func (t *Transaction) DeleteWhere(ctx context.Context, s Struct, q *QueryStmt) (int64, error) {
+	return deleteWhereStruct(t, ctx, s, q)
+}
+
 // Exec executes a query that doesn't return rows. For example: an INSERT and UPDATE.
 func (t *Transaction) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 	query = formatQuery(query)
@@ -21,7 +21,7 @@ func TestNewTransaction(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestNewTransaction_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestNewTransaction_Struct{})))
 
 	// insert new record in successful transaction
 	{
@@ -76,7 +76,7 @@ func TestTransaction(t *testing.T) {
 	db.Logger = log
 
 	// create table
-	require.NoError(t, db.ensureTable(mustNewMetaStruct(&TestTransaction_Struct{})))
+	require.NoError(t, db.ensureTable(context.Background(), mustNewMetaStruct(&TestTransaction_Struct{})))
 
 	// insert new record in successful transaction
 	{
@@ -101,4 +101,14 @@ func TestTransaction(t *testing.T) {
 		requirePQError(t, err, "unique_violation")
 		require.Error(t, rescueTx.Commit()) // transaction has already been rolled back
 	}
+	// cancelled context doesn't start a transaction
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := db.TransactionContext(ctx, func(tx *Transaction) error {
+			t.Fatal("TransactionFunc must not be called")
+			return nil
+		})
+		require.Equal(t, context.Canceled, err)
+	}
 }
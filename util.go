@@ -3,6 +3,7 @@ package postgres
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/azer/snakecase"
@@ -110,6 +111,25 @@ func removeFromStringSlice(old []string, remove string) []string {
 	return x
 }
 
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string][]string) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
 func isErrTableDoesNotExist(err error) bool {
 	if err == nil {
 		return false